@@ -1,26 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/zono-dev/withings-go/withings"
+	"golang.org/x/oauth2"
 )
 
 const (
 	tokenFile = "access_token.json"
 	layout    = "2006-01-02"
 	layout2   = "2006-01-02 15:04:05"
+	// authTimeout is how long to wait for the redirect in loopback authorization.
+	authTimeout = 5 * time.Minute
 )
 
 var (
 	client   *(withings.Client)
-	settings map[string]string
+	settings *withings.Settings
 )
 
 func auth() {
 	var err error
-	client, err = withings.New(settings["CID"], settings["Secret"], settings["RedirectURL"])
+	// The token is read from and saved to tokenFile by the client.
+	store := &withings.FileTokenStore{Path: tokenFile}
+	client, err = withings.NewWithStore(settings.ClientID, settings.ClientSecret, settings.RedirectURL, store, "")
 
 	if err != nil {
 		fmt.Println("Failed to create New client")
@@ -30,33 +38,50 @@ func auth() {
 	// default Scope: user.activity,user.metrics,user.info
 	fmt.Println(client.Conf.Scopes)
 
-	// When first time you authorize with Withings API, you need to call AuthorizeOffline.
-	if _, err := os.Open(tokenFile); err != nil {
-		var e error
-
-		client.Token, e = withings.AuthorizeOffline(client.Conf)
-		client.Client = withings.GetClient(client.Conf, client.Token)
+	// Client uses token file if it has been in tokenFile path.
+	if client.HasToken() {
+		return
+	}
 
-		if e != nil {
-			fmt.Println("Failed to authorize offline.")
-		}
+	// When first time you authorize with Withings API, you need to use LoopbackAuthorizer or AuthorizeInteractive.
+	var token *oauth2.Token
+	if isLoopback(client.Conf.RedirectURL) {
+		// RedirectURL points to this machine, so the grant code can be received automatically.
+		a := &withings.LoopbackAuthorizer{Conf: client.Conf, Timeout: authTimeout, Out: os.Stdout}
+		token, err = a.Authorize(context.Background())
 	} else {
-		// Client can use token file if it has been in tokenFile path.
-		_, err = client.ReadToken(tokenFile)
+		token, err = withings.AuthorizeInteractive(context.Background(), client.Conf, os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		fmt.Println("Failed to authorize.")
+		fmt.Println(err)
+		return
+	}
+
+	if err := client.SetToken(token); err != nil {
+		fmt.Println("Failed to save token.")
+		fmt.Println(err)
+	}
+}
 
-		if err != nil {
-			fmt.Println("Failed to read token file.")
-			fmt.Println(err)
-			return
-		}
+// isLoopback reports whether redirectURL points to this machine.
+func isLoopback(redirectURL string) bool {
+	u, err := url.Parse(redirectURL)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
 	}
+	return false
 }
 
 func tokenFuncs() {
 	// Show token
-	client.PrintToken()
+	fmt.Println(client.TokenInfo())
 
-	// Refresh Token if you need
+	// Refresh Token if you need. The new token is saved to tokenFile.
 	_, rf, err := client.RefreshToken()
 	if err != nil {
 		fmt.Println("Failed to RefreshToken")
@@ -65,21 +90,18 @@ func tokenFuncs() {
 	}
 	if rf {
 		fmt.Println("You got new token!")
-		client.PrintToken()
+		fmt.Println(client.TokenInfo())
 	}
+}
 
-	// Save Token if you need
-	err = client.SaveToken(tokenFile)
+func main() {
+	var err error
+	settings, err = withings.LoadSettings(".test_settings.yaml")
 	if err != nil {
-		fmt.Println("Failed to RefreshToken")
+		fmt.Println("Failed to load settings")
 		fmt.Println(err)
 		return
 	}
-}
-
-func main() {
-	settings = withings.ReadSettings(".test_settings.yaml")
-	fmt.Println(settings)
 	auth()
 	tokenFuncs()
 }
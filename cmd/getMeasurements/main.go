@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"os"
@@ -24,12 +25,14 @@ var (
 	ed         string
 	sd         string
 	client     *(withings.Client)
-	settings   map[string]string
+	settings   *withings.Settings
 )
 
-func auth(settings map[string]string) {
+func auth(settings *withings.Settings) {
 	var err error
-	client, err = withings.New(settings["CID"], settings["Secret"], settings["RedirectURL"])
+	// The token is read from and saved to tokenFile by the client.
+	store := &withings.FileTokenStore{Path: tokenFile}
+	client, err = withings.NewWithStore(settings.ClientID, settings.ClientSecret, settings.RedirectURL, store, "")
 
 	if err != nil {
 		fmt.Println("Failed to create New client")
@@ -37,32 +40,29 @@ func auth(settings map[string]string) {
 		return
 	}
 
-	if _, err := os.Open(tokenFile); err != nil {
-		var e error
-
-		client.Token, e = withings.AuthorizeOffline(client.Conf)
-		client.Client = withings.GetClient(client.Conf, client.Token)
+	if client.HasToken() {
+		return
+	}
 
-		if e != nil {
-			fmt.Println("Failed to authorize offline.")
-		}
-		fmt.Println("~~ authorized. Let's check the token file!")
-	} else {
-		_, err = client.ReadToken(tokenFile)
-
-		if err != nil {
-			fmt.Println("Failed to read token file.")
-			fmt.Println(err)
-			return
-		}
+	token, err := withings.AuthorizeInteractive(context.Background(), client.Conf, os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Println("Failed to authorize.")
+		fmt.Println(err)
+		return
+	}
+	if err := client.SetToken(token); err != nil {
+		fmt.Println("Failed to save token.")
+		fmt.Println(err)
+		return
 	}
+	fmt.Println("~~ authorized. Let's check the token file!")
 }
 
 func tokenFuncs() {
 	// Show token
-	client.PrintToken()
+	fmt.Println(client.TokenInfo())
 
-	// Refresh Token if you need
+	// Refresh Token if you need. The new token is saved to tokenFile.
 	_, rf, err := client.RefreshToken()
 	if err != nil {
 		fmt.Println("Failed to RefreshToken")
@@ -71,15 +71,7 @@ func tokenFuncs() {
 	}
 	if rf {
 		fmt.Println("You got new token!")
-		client.PrintToken()
-	}
-
-	// Save Token if you need
-	err = client.SaveToken(tokenFile)
-	if err != nil {
-		fmt.Println("Failed to RefreshToken")
-		fmt.Println(err)
-		return
+		fmt.Println(client.TokenInfo())
 	}
 }
 
@@ -241,7 +233,13 @@ func testGetsleepsummary() {
 
 func main() {
 
-	settings = withings.ReadSettings(".test_settings.yaml")
+	var err error
+	settings, err = withings.LoadSettings(".test_settings.yaml")
+	if err != nil {
+		fmt.Println("Failed to load settings")
+		fmt.Println(err)
+		return
+	}
 
 	auth(settings)
 	tokenFuncs()
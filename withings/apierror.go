@@ -0,0 +1,98 @@
+package withings
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Classifications of APIError. Check them with errors.Is.
+var (
+	ErrAuthFailure    = errors.New("authentication failed")
+	ErrInvalidParams  = errors.New("invalid params")
+	ErrRateLimited    = errors.New("too many requests")
+	ErrServerError    = errors.New("server error")
+	ErrNotImplemented = errors.New("not implemented")
+)
+
+// APIError is returned when withings rejected the request.
+// Withings responds HTTP 200 with non-zero status in the body for failures.
+// See https://developer.withings.com/api-reference/#section/Response-status .
+type APIError struct {
+	// Action is the action of the request (e.g. getmeas).
+	Action string
+	// Status is the status in the response body. It is 0 if HTTPStatus is set.
+	Status int
+	// HTTPStatus is the HTTP status code if it was not 200.
+	HTTPStatus int
+	// Message is the error in the response body.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	var s string
+	if e.HTTPStatus != 0 {
+		s = fmt.Sprintf("withings api %s: http status %d", e.Action, e.HTTPStatus)
+	} else {
+		s = fmt.Sprintf("withings api %s: status %d", e.Action, e.Status)
+	}
+	if kind := e.Kind(); kind != nil {
+		s += " (" + kind.Error() + ")"
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// Is reports whether target is the classification of e.
+func (e *APIError) Is(target error) bool {
+	kind := e.Kind()
+	return kind != nil && kind == target
+}
+
+// Kind returns the classification of e (e.g. ErrRateLimited), or nil if it is unknown.
+func (e *APIError) Kind() error {
+	if e.HTTPStatus != 0 {
+		return classifyHTTPStatus(e.HTTPStatus)
+	}
+	return classifyStatus(e.Status)
+}
+
+// classifyStatus classifies withings status.
+func classifyStatus(status int) error {
+	switch {
+	case status == 0:
+		return nil
+	case status == 100, status == 101, status == 102, status == 200, status == 401,
+		status == 214, status == 277, status == 2553, status == 2554:
+		return ErrAuthFailure
+	case status == 601:
+		return ErrRateLimited
+	case status == 274, status == 522, status == 2555, status >= 5000:
+		return ErrServerError
+	case status == 2556:
+		return ErrNotImplemented
+	case status >= 201 && status < 600, status >= 3017 && status <= 3019:
+		return ErrInvalidParams
+	}
+	return nil
+}
+
+// classifyHTTPStatus classifies HTTP status code other than 200.
+func classifyHTTPStatus(code int) error {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return ErrAuthFailure
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == http.StatusNotImplemented:
+		return ErrNotImplemented
+	case code >= 500:
+		return ErrServerError
+	case code >= 400:
+		return ErrInvalidParams
+	}
+	return nil
+}
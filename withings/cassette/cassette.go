@@ -0,0 +1,288 @@
+// Package cassette records withings requests and responses to a file and replays them,
+// so tests of withings clients run offline.
+//
+// Record a session once against the real api,
+//
+//	rec, err := cassette.New("testdata/getmeas.json", cassette.ModeRecord)
+//	client, err := withings.New(cid, secret, redirectURL, withings.WithTransport(rec))
+//	... call the api ...
+//	err = rec.Save()
+//
+// and replay it with cassette.ModeReplay. Access tokens, refresh tokens, userids and client secrets
+// are scrubbed before they are saved. Requests are matched by method, path, action and form params.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zono-dev/withings-go/withings/internal/redact"
+)
+
+// EnvMode is the environment variable read by ModeFromEnv.
+const EnvMode = "WITHINGS_CASSETTE"
+
+// Mode is the mode of Recorder.
+type Mode int
+
+// Modes of Recorder.
+const (
+	// ModeReplay replays the recorded responses and never sends requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests and records them. Save writes them to the file.
+	ModeRecord
+)
+
+// ModeFromEnv returns ModeRecord if the environment variable WITHINGS_CASSETTE is "record", otherwise ModeReplay.
+func ModeFromEnv() Mode {
+	if strings.EqualFold(os.Getenv(EnvMode), "record") {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// ErrNoInteraction is returned when no recorded interaction matches the request.
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// Request is a recorded request.
+type Request struct {
+	Method string     `json:"method"`
+	URL    string     `json:"url"`
+	Action string     `json:"action,omitempty"`
+	Form   url.Values `json:"form,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Interaction is a pair of recorded request and response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is http.RoundTripper which records or replays the interactions.
+// Recorder is safe for concurrent use.
+type Recorder struct {
+	// Transport sends the requests in ModeRecord. http.DefaultTransport is used if nil.
+	Transport http.RoundTripper
+	// IgnoreParams are the form params not compared in ModeReplay, e.g. startdate of time.Now().
+	// Scrubbed params, client_id and redirect_uri are never compared, so a cassette can be replayed by another app.
+	IgnoreParams []string
+
+	path string
+	mode Mode
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// New returns Recorder of the cassette file path. The file is loaded in ModeReplay.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode}
+	if mode != ModeReplay {
+		return r, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.cassette); err != nil {
+		return nil, fmt.Errorf("cannot decode cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.cassette.Interactions))
+	return r, nil
+}
+
+// Mode returns the mode of r.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Interactions returns the recorded interactions.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.cassette.Interactions...)
+}
+
+// RoundTrip records or replays the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recReq := newRequest(req, body)
+
+	if r.mode == ModeReplay {
+		return r.replay(req, recReq)
+	}
+	return r.record(req, recReq)
+}
+
+// readBody reads the body of req and restores it.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// newRequest returns the scrubbed Request of req.
+func newRequest(req *http.Request, body []byte) Request {
+	form := url.Values{}
+	if len(body) > 0 {
+		if v, err := url.ParseQuery(string(body)); err == nil {
+			form = v
+		}
+	}
+	return Request{
+		Method: req.Method,
+		URL:    redact.URL(req.URL).String(),
+		Action: form.Get("action"),
+		Form:   redact.Form(form),
+	}
+}
+
+func (r *Recorder) record(req *http.Request, recReq Request) (*http.Response, error) {
+	rt := r.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	header := redact.Header(resp.Header)
+	// The length changes by scrubbing.
+	header.Del("Content-Length")
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: recReq,
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       string(redact.JSON(b)),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recReq Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || !r.match(in.Request, recReq) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s action=%s form=%s", ErrNoInteraction, recReq.Method, recReq.URL, recReq.Action, recReq.Form.Encode())
+}
+
+// match reports whether the recorded request matches req.
+// The scheme and the host are not compared, so a cassette can be replayed with another base url.
+func (r *Recorder) match(recorded, req Request) bool {
+	if recorded.Method != req.Method || recorded.Action != req.Action {
+		return false
+	}
+	ru, err1 := url.Parse(recorded.URL)
+	qu, err2 := url.Parse(req.URL)
+	if err1 != nil || err2 != nil || ru.Path != qu.Path || ru.RawQuery != qu.RawQuery {
+		return false
+	}
+	return reflect.DeepEqual(r.comparable(recorded.Form), r.comparable(req.Form))
+}
+
+// appParams are the form params which depend on the app.
+var appParams = []string{"client_id", "redirect_uri"}
+
+// comparable returns the form params to compare.
+func (r *Recorder) comparable(form url.Values) url.Values {
+	out := url.Values{}
+	for k, v := range form {
+		if redact.IsSensitive(k) || contains(appParams, k) || contains(r.IgnoreParams, k) {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the recorded interactions to the cassette file in ModeRecord.
+// It does nothing in ModeReplay.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mu.Lock()
+	c := Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+	r.mu.Unlock()
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(b, '\n'), 0644)
+}
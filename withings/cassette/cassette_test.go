@@ -0,0 +1,139 @@
+package cassette
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/zono-dev/withings-go/withings"
+)
+
+const (
+	secretAccessToken  = "a075f8c14fb8df40b08ebc8508533dc332a6910a"
+	secretRefreshToken = "f58ba3a9be4e2b7d9de9aeaf6b9a17f1ab3fcc30"
+	secretUserID       = "87654321"
+	secretClient       = "secret0123456789"
+)
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":0,"body":{"userid":"%s","access_token":"%s","refresh_token":"%s","expires_in":10800,"scope":"user.metrics","token_type":"Bearer"}}`,
+			secretUserID, secretAccessToken, secretRefreshToken)
+	})
+	mux.HandleFunc("/measure", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session="+secretAccessToken)
+		fmt.Fprint(w, `{"status":0,"body":{"updatetime":1609766464,"timezone":"Asia/Tokyo","measuregrps":[{"grpid":1,"attrib":0,"date":1609754636,"category":1,"measures":[{"value":81200,"type":1,"unit":-3}]}]}}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func getMeas(t *testing.T, rec *Recorder, baseURL string, start time.Time) (*withings.Measurement, error) {
+	c, err := withings.New("cid", secretClient, "http://localhost/callback",
+		withings.WithBaseURL(baseURL), withings.WithTransport(rec), withings.WithRetry(withings.NoRetry))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	expired := &oauth2.Token{AccessToken: "expired-" + secretAccessToken, RefreshToken: "old-" + secretRefreshToken, Expiry: time.Now().Add(-time.Hour)}
+	c.SetToken(expired.WithExtra(map[string]interface{}{"userid": secretUserID}))
+	return c.GetMeas(withings.Real, start, start.Add(24*time.Hour), withings.OffsetBase, 0, false, false, withings.Weight)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ts := newServer()
+	path := filepath.Join(t.TempDir(), "cassettes", "getmeas.json")
+	start := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+	rec, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	if _, err := getMeas(t, rec, ts.URL, start); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+	ts.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile returns error(%v)", err)
+	}
+	for _, secret := range []string{secretAccessToken, secretRefreshToken, secretUserID, secretClient} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("cassette has the secret %s", secret)
+		}
+	}
+	if ins := rec.Interactions(); len(ins) != 2 || ins[0].Request.Action != "requesttoken" || ins[1].Request.Action != "getmeas" {
+		t.Fatalf("recorded interactions = %+v", ins)
+	}
+
+	// The server is closed, so the responses come from the cassette.
+	rep, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	mym, err := getMeas(t, rep, "http://replay.invalid", start)
+	if err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if len(mym.Body.Measuregrps) != 1 || mym.Body.Measuregrps[0].Measures[0].Value != 81200 {
+		t.Errorf("replayed measures = %+v", mym.Body.Measuregrps)
+	}
+
+	// Each interaction is replayed once.
+	if _, err := getMeas(t, rep, "http://replay.invalid", start); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("GetMeas returns error(%v), want %v", err, ErrNoInteraction)
+	}
+}
+
+func TestReplayMatch(t *testing.T) {
+	ts := newServer()
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "getmeas.json")
+	start := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+	rec, _ := New(path, ModeRecord)
+	if _, err := getMeas(t, rec, ts.URL, start); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+
+	rep, _ := New(path, ModeReplay)
+	if _, err := getMeas(t, rep, ts.URL, start.Add(time.Hour)); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("GetMeas with another startdate returns error(%v), want %v", err, ErrNoInteraction)
+	}
+
+	rep, _ = New(path, ModeReplay)
+	rep.IgnoreParams = []string{"startdate", "enddate"}
+	if _, err := getMeas(t, rep, ts.URL, start.Add(time.Hour)); err != nil {
+		t.Errorf("GetMeas ignoring dates returns error(%v)", err)
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	t.Setenv(EnvMode, "record")
+	if ModeFromEnv() != ModeRecord {
+		t.Error("ModeFromEnv is not ModeRecord")
+	}
+	t.Setenv(EnvMode, "")
+	if ModeFromEnv() != ModeReplay {
+		t.Error("ModeFromEnv is not ModeReplay")
+	}
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Error("New returns no error for a missing cassette in ModeReplay")
+	}
+}
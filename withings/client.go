@@ -9,24 +9,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
-	"gopkg.in/yaml.v2"
 )
 
 const (
-	authURL          = "http://account.withings.com/oauth2_user/authorize2"
-	tokenURL         = "https://wbsapi.withings.net/v2/oauth2"
 	defaultTokenFile = ".access_token.json"
 )
 
 // Client type
+// Client is safe for concurrent use by multiple goroutines once it is configured.
+// Client and Token must not be modified directly while the client is in use. Use SetToken instead.
 type Client struct {
 	Client       *http.Client
 	Conf         *oauth2.Config
@@ -35,53 +38,77 @@ type Client struct {
 	MeasureURL   string
 	MeasureURLv2 string
 	SleepURLv2   string
+	// UserAgent is User-Agent header of API requests if it is set.
+	UserAgent string
+	// Logger logs retries and token refreshes. Nothing is logged if it is nil.
+	Logger *slog.Logger
+	// Store persists the token if it is set. See NewWithStore.
+	Store TokenStore
+	// RetryPolicy decides whether and when failed API calls are retried.
+	// It can be overridden per call with WithRetryPolicy.
+	RetryPolicy RetryPolicy
+	// RateLimiter throttles the requests of Do if it is set. Share one among the clients of the app.
+	RateLimiter *RateLimiter
+	// TokenCipher encrypts the token file of ReadToken and SaveToken if it is set.
+	TokenCipher *TokenCipher
+	// OnTokenRefresh is called with the new token whenever the token is refreshed,
+	// including refreshes done behind Do when the access token expired.
+	OnTokenRefresh func(*oauth2.Token) error
+
+	// transport is the base http.RoundTripper of Client. See WithTransport.
+	transport http.RoundTripper
+	// middlewares wrap transport. See Use.
+	middlewares []Middleware
+	// chain is transport wrapped by middlewares. See roundTripper.
+	chain http.RoundTripper
+	// observers observe the API calls. See Observe.
+	observers []CallObserver
+
+	// mu guards Token, Client and the fields below.
+	mu sync.RWMutex
+	// refreshing is the semaphore which allows only one refresh at a time.
+	refreshing chan struct{}
+	// pending is the refreshed token which OnTokenRefresh or Store failed to handle.
+	pending *oauth2.Token
 }
 
-// ClientOption type for to customize http.Client
-type ClientOption func(*http.Client) error
-
 // AuthorizeOffline provides oauth2 authorization for withings in CLI.
-// See example/main.go to know the detail.
+// Paste the whole URL your browser was redirected to, so that its state can be verified.
+//
+// Deprecated: AuthorizeOffline reads os.Stdin and writes to os.Stdout. Use AuthorizeInteractive instead.
 func AuthorizeOffline(conf *oauth2.Config) (*oauth2.Token, error) {
+	return AuthorizeInteractive(context.Background(), conf, os.Stdin, os.Stdout)
+}
 
-	url := conf.AuthCodeURL("state", oauth2.AccessTypeOffline)
-
-	fmt.Printf("URL to authorize:%s\n", url)
-
-	var grantcode string
-	fmt.Printf("Open url your browser and Enter your grant code here.\n Grant Code:")
-	fmt.Scan(&grantcode)
+// AuthorizeInteractive provides oauth2 authorization for withings in CLI.
+// It writes the URL to authorize to out and reads the whole URL your browser was redirected to from in,
+// so that its state can be verified.
+func AuthorizeInteractive(ctx context.Context, conf *oauth2.Config, in io.Reader, out io.Writer) (*oauth2.Token, error) {
 
-	token, err := conf.Exchange(newOauthContext(), grantcode)
+	authURL, state, err := AuthCodeURL(conf)
 	if err != nil {
-		fmt.Println("Failed to oauth2 exchange.")
 		return nil, err
 	}
 
-	return token, nil
-}
+	fmt.Fprintf(out, "URL to authorize:%s\n", authURL)
 
-// ReadSettings read setting file which is yaml file and returns the settings.
-func ReadSettings(path2settings string) map[string]string {
-	f, err := os.Open(path2settings)
-	if err != nil {
-		log.Fatal(err)
+	var redirected string
+	fmt.Fprintf(out, "Open url your browser and Enter the redirected URL here.\n Redirected URL:")
+	if _, err := fmt.Fscan(in, &redirected); err != nil {
+		return nil, fmt.Errorf("cannot read redirected url: %v", err)
 	}
-	defer f.Close()
-
-	d := yaml.NewDecoder(f)
-	var m map[string]string
 
-	if err := d.Decode(&m); err != nil {
-		log.Fatal(err)
+	u, err := url.Parse(redirected)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse redirected url: %v", err)
 	}
 
-	return m
-}
+	token, err := ExchangeCallback(ctx, conf, state, u.Query())
+	if err != nil {
+		return nil, fmt.Errorf("failed to oauth2 exchange: %w", err)
+	}
 
-// getNewContext returns new context that has Timeout settings.
-func getNewContext(timeout time.Duration) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), timeout)
+	return token, nil
 }
 
 // New returns new client.
@@ -91,15 +118,15 @@ func New(cid, secret, redirectURL string, options ...ClientOption) (*Client, err
 	conf := GetNewConf(cid, secret, redirectURL)
 	c := &Client{}
 	c.Conf = &conf
-	c.Token = &oauth2.Token{}
-	c.Client = GetClient(c.Conf, c.Token)
+	c.setTokenLocked(&oauth2.Token{})
 	c.Timeout = 5 * time.Second
+	c.RetryPolicy = DefaultRetryPolicy
 	c.MeasureURL = defaultMeasureURL
 	c.MeasureURLv2 = defaultMeasureURLv2
 	c.SleepURLv2 = defaultSleepURLv2
 
 	for _, option := range options {
-		err := option(c.Client)
+		err := option(c)
 		if err != nil {
 			return nil, err
 		}
@@ -108,9 +135,25 @@ func New(cid, secret, redirectURL string, options ...ClientOption) (*Client, err
 	return c, nil
 }
 
+// NewWithStore returns new client which loads and persists its token with store.
+// The token of userid is loaded if store has it. Otherwise the client has no token,
+// so authorize (e.g. AuthorizeLoopback) and pass the token to SetToken.
+func NewWithStore(cid, secret, redirectURL string, store TokenStore, userid string, options ...ClientOption) (*Client, error) {
+	c, err := New(cid, secret, redirectURL, options...)
+	if err != nil {
+		return nil, err
+	}
+	c.Store = store
+
+	if _, err := c.LoadToken(userid); err != nil && !errors.Is(err, ErrTokenNotFound) {
+		return nil, err
+	}
+	return c, nil
+}
+
 // SetScope sets scope for oauth2 client.
-func (c *Client) SetScope(scopes ...string) {
-	c.Conf.Scopes = []string{strings.Join([]string(scopes), ",")}
+func (c *Client) SetScope(scopes ...Scope) {
+	c.Conf.Scopes = []string{joinScopes(scopes)}
 }
 
 // SetTimeout sets timeout setting for http client.
@@ -118,96 +161,260 @@ func (c *Client) SetTimeout(timeout time.Duration) {
 	c.Timeout = timeout * time.Second
 }
 
-// PrintTimeout print timeout setting.
+// PrintTimeout logs timeout setting to Client.Logger.
+//
+// Deprecated: Use Client.Timeout instead.
 func (c *Client) PrintTimeout() {
-	fmt.Printf("Timeout=%v\n", c.Timeout)
+	c.logger().Info("withings client timeout", "timeout", c.Timeout)
 }
 
-// ReadToken read from a file and that token is set to client.
-func (c *Client) ReadToken(path2file string) (*oauth2.Token, error) {
-	t, err := readToken(path2file)
+// HasToken reports whether the client has a token to access withings api.
+func (c *Client) HasToken() bool {
+	t := c.CurrentToken()
+	return t != nil && (t.AccessToken != "" || t.RefreshToken != "")
+}
+
+// CurrentToken returns the token of client.
+func (c *Client) CurrentToken() *oauth2.Token {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Token
+}
+
+// SetToken sets the token to client and saves it to Store if Store is set.
+// A nil token cannot be saved, so it is an error if Store is set.
+func (c *Client) SetToken(t *oauth2.Token) error {
+	c.mu.Lock()
+	c.setTokenLocked(t)
+	c.mu.Unlock()
+	return c.StoreToken()
+}
+
+// LoadToken loads the token of userid from Store and that token is set to client.
+func (c *Client) LoadToken(userid string) (*oauth2.Token, error) {
+	if c.Store == nil {
+		return nil, errors.New("token store is not set")
+	}
+	t, err := c.Store.Load(userid)
 	if err != nil {
 		return nil, err
 	}
-	c.Token = t
-	c.Client = GetClient(c.Conf, c.Token)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTokenLocked(t)
 	return c.Token, nil
 }
 
-func readToken(path2file string) (*oauth2.Token, error) {
-	token := &oauth2.Token{}
-	file, err := os.Open(path2file)
-	if err == nil {
-		json.NewDecoder(file).Decode(token)
+// StoreToken saves the token to Store. It does nothing if Store is not set.
+func (c *Client) StoreToken() error {
+	if c.Store == nil {
+		return nil
 	}
-	return token, err
+	return c.storeToken(c.CurrentToken())
 }
 
-// SaveToken save the token in the file.
-func (c *Client) SaveToken(path2file string) error {
-	var fname string = path2file
-	if fname == "" {
-		fname = defaultTokenFile
+func (c *Client) storeToken(t *oauth2.Token) error {
+	if c.Store == nil {
+		return nil
+	}
+	if t == nil {
+		return errors.New("token is nil")
 	}
-	return saveToken(c.Token, fname)
+	return c.Store.Save(TokenUserID(t), t)
 }
 
-func saveToken(t *oauth2.Token, path2file string) error {
-	file, err := os.Create(path2file)
+// ReadToken read from a file and that token is set to client.
+// If TokenCipher is set, the file is decrypted, and a plaintext file is rewritten encrypted.
+func (c *Client) ReadToken(path2file string) (*oauth2.Token, error) {
+	t, err := readTokenFile(path2file, c.TokenCipher)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTokenLocked(t)
+	return c.Token, nil
+}
 
-	err = json.NewEncoder(file).Encode(t)
-	if err != nil {
-		return err
+// SaveToken save the token in the file. The file is encrypted if TokenCipher is set.
+func (c *Client) SaveToken(path2file string) error {
+	var fname string = path2file
+	if fname == "" {
+		fname = defaultTokenFile
 	}
-	return nil
+	return writeTokenFile(fname, c.CurrentToken(), c.TokenCipher)
 }
 
 // RefreshToken get new token if necessary.
+// The new token is saved to Store if Store is set and passed to OnTokenRefresh.
+// Only one refresh runs at a time. Concurrent callers wait for it and get its result.
 func (c *Client) RefreshToken() (*oauth2.Token, bool, error) {
-	newToken, err := refreshToken(c.Conf, c.Token)
+	return c.RefreshTokenContext(context.Background())
+}
+
+// RefreshTokenContext is RefreshToken with ctx, which cancels the refresh request.
+func (c *Client) RefreshTokenContext(ctx context.Context) (*oauth2.Token, bool, error) {
+	old := c.CurrentToken()
+	newToken, err := c.token(ctx)
 	if err != nil {
 		return nil, false, err
 	}
+	return newToken, newToken.AccessToken != old.AccessToken, nil
+}
+
+// token returns the valid token of client, refreshing the expired token with ctx.
+// If handling the refreshed token failed (e.g. Store returns error), the error is returned
+// and it is handled again on the next call.
+func (c *Client) token(ctx context.Context) (*oauth2.Token, error) {
+	c.mu.RLock()
+	t, pending, sem := c.Token, c.pending, c.refreshing
+	c.mu.RUnlock()
+	if t.Valid() && pending == nil {
+		return t, nil
+	}
+
+	// Concurrent requests wait for one refresh, so the token is not refreshed several times.
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-sem }()
+
+	c.mu.RLock()
+	t = c.Token
+	c.mu.RUnlock()
+	if !t.Valid() {
+		nt, err := c.Conf.TokenSource(newOauthContextWithTransport(ctx, c.roundTripper()), t).Token()
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.Token != t {
+			// SetToken was called during the refresh.
+			t = c.Token
+			c.mu.Unlock()
+			return t, nil
+		}
+		c.Token = nt
+		c.pending = nt
+		c.mu.Unlock()
+		t = nt
+		c.logger().InfoContext(ctx, "withings token refreshed", "userid", TokenUserID(nt))
+	}
+
+	c.mu.RLock()
+	pending = c.pending
+	c.mu.RUnlock()
+	if pending == nil || pending != t {
+		return t, nil
+	}
+	if err := c.tokenRefreshed(t); err != nil {
+		c.logger().WarnContext(ctx, "cannot handle refreshed withings token", "userid", TokenUserID(t), "error", err)
+		return nil, fmt.Errorf("cannot handle refreshed token: %w", err)
+	}
+	c.mu.Lock()
+	if c.pending == t {
+		c.pending = nil
+	}
+	c.mu.Unlock()
+	return t, nil
+}
 
-	var isNewToken bool = false
+// setTokenLocked sets the token and creates *http.Client for the client if it does not exist.
+// c.mu must be held.
+func (c *Client) setTokenLocked(t *oauth2.Token) {
+	c.Token = t
+	c.pending = nil
+	if c.refreshing == nil {
+		c.refreshing = make(chan struct{}, 1)
+	}
+	if c.Client == nil {
+		c.Client = &http.Client{Transport: &tokenTransport{c: c}}
+	}
+}
 
-	if newToken != c.Token {
-		c.Token = newToken
-		c.Client = GetClient(c.Conf, c.Token)
-		isNewToken = true
+// tokenRefreshed calls OnTokenRefresh with the refreshed token and saves it to Store.
+func (c *Client) tokenRefreshed(t *oauth2.Token) error {
+	if c.OnTokenRefresh != nil {
+		if err := c.OnTokenRefresh(t); err != nil {
+			return err
+		}
 	}
+	return c.storeToken(t)
+}
 
-	return c.Token, isNewToken, nil
+// tokenTransport authorizes requests with the token of the client.
+// The token is refreshed with the context of the request when it expired.
+type tokenTransport struct {
+	c *Client
 }
 
-func refreshToken(conf *oauth2.Config, token *oauth2.Token) (*oauth2.Token, error) {
-	newToken, err := (conf.TokenSource(newOauthContext(), token).Token())
+// RoundTrip sets Authorization header to the request.
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.c.token(req.Context())
 	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
 		return nil, err
 	}
-	return newToken, nil
+
+	// RoundTrip must not modify the request.
+	req2 := req.Clone(req.Context())
+	token.SetAuthHeader(req2)
+	if t.c.UserAgent != "" {
+		req2.Header.Set("User-Agent", t.c.UserAgent)
+	}
+
+	return t.c.roundTripper().RoundTrip(req2)
+}
+
+// discardLogger is used when Client.Logger is nil.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// logger returns Logger of client, or the logger which discards logs if it is not set.
+func (c *Client) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return discardLogger
+}
+
+// httpClient returns *http.Client of client.
+func (c *Client) httpClient() *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Client == nil {
+		c.setTokenLocked(c.Token)
+	}
+	return c.Client
 }
 
 // Do is just call `Do` of http.Client.
+// It waits for RateLimiter before sending the request if RateLimiter is set.
+// The expired token is refreshed with the context of req.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
-	ret, err := c.Client.Do(req)
+	ctx, _, err := c.waitRateLimit(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	ret, err := c.httpClient().Do(req.WithContext(ctx))
 	return ret, err
 }
 
 // GetNewConf returns oauth2.Config with client id, secret, and redirectURL
 func GetNewConf(cid, secret, redirectURL string) oauth2.Config {
-	scopes := []string{ScopeActivity, ScopeMetrics, ScopeInfo}
+	scopes := []Scope{ScopeActivity, ScopeMetrics, ScopeInfo}
 	conf := oauth2.Config{
 		RedirectURL:  redirectURL,
 		ClientID:     cid,
 		ClientSecret: secret,
-		Scopes:       []string{strings.Join([]string(scopes), ",")},
+		Scopes:       []string{joinScopes(scopes)},
 		Endpoint: oauth2.Endpoint{
-			AuthURL:   authURL,
-			TokenURL:  tokenURL,
+			AuthURL:   DefaultEndpoints.AuthURL,
+			TokenURL:  DefaultEndpoints.TokenURL,
 			AuthStyle: oauth2.AuthStyleInParams,
 		},
 	}
@@ -216,71 +423,79 @@ func GetNewConf(cid, secret, redirectURL string) oauth2.Config {
 
 // GetClient returns *http.Client which based on conf, token.
 func GetClient(conf *oauth2.Config, token *oauth2.Token) *http.Client {
-	client := oauth2.NewClient(context.Background(), conf.TokenSource(newOauthContext(), token))
+	client := oauth2.NewClient(context.Background(), conf.TokenSource(newOauthContext(context.Background()), token))
 	return client
 }
 
-// PrintToken print token information.
+// PrintToken logs token information to Client.Logger. The tokens are masked.
+//
+// Deprecated: Use TokenInfo instead.
 func (c *Client) PrintToken() {
-	printToken(c.Token)
-}
-
-func printToken(t *oauth2.Token) {
-	layout := "2006-01-02 15:04:05"
-	extraKeys := []string{"access_token", "expires_in", "refresh_token", "scope", "token_type", "userid"}
-
-	fmt.Printf("--Token Information--\n")
-	fmt.Printf("AccessToken:%s\n", t.AccessToken)
-	fmt.Printf("RefreshToken:%s\n", t.RefreshToken)
-	fmt.Printf("ExpiryDate:%s\n", t.Expiry.Format(layout))
-	fmt.Printf("TokenType:%s\n", t.TokenType)
-
-	// Extra returns interface{}
-	for _, k := range extraKeys {
-		switch val := t.Extra(k).(type) {
-		case string:
-			fmt.Printf("%s:%s\n", k, val)
-		case float64:
-			fmt.Printf("%s:%g\n", k, val)
-		default:
-			if val != nil {
-				fmt.Println(val)
-			}
+	c.logger().Info("withings token", "token", c.TokenInfo())
+}
+
+// PrintConf logs conf information to Client.Logger. The client secret is masked.
+//
+// Deprecated: Use ConfInfo instead.
+func (c *Client) PrintConf() {
+	c.logger().Info("withings conf", "conf", c.ConfInfo())
+}
+
+// newOauthContext returns context.Context derived from ctx with
+// custom http client for withings's access and refresh tokens endpoints.
+// If ctx has *http.Client as oauth2.HTTPClient, its Transport is used as the base transport.
+func newOauthContext(ctx context.Context) context.Context {
+	var base http.RoundTripper
+	if hc, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		if _, ok := hc.Transport.(*oauthTransport); ok {
+			return ctx
 		}
+		base = hc.Transport
 	}
+	return newOauthContextWithTransport(ctx, base)
 }
 
-// PrintConf print conf information.
-func (c *Client) PrintConf() {
-	printConf(c.Conf)
+// newOauthContextWithTransport is newOauthContext which sends the token requests with base.
+// http.DefaultTransport is used if base is nil.
+func newOauthContextWithTransport(ctx context.Context, base http.RoundTripper) context.Context {
+	c := &http.Client{Transport: NewTokenTransport(base)}
+	return context.WithValue(ctx, oauth2.HTTPClient, c)
 }
 
-func printConf(conf *oauth2.Config) {
-	fmt.Printf("RedirectURL: %v\n", conf.RedirectURL)
-	fmt.Printf("ClientID: %v\n", conf.ClientID)
-	fmt.Printf("ClientSecret: %v\n", conf.ClientSecret)
-	fmt.Printf("Scopes: %v\n", conf.Scopes)
-	fmt.Printf("Endpoint(AuthURL): %v\n", conf.Endpoint.AuthURL)
-	fmt.Printf("Endpoint(TokenURL): %v\n", conf.Endpoint.TokenURL)
+// contextWithTransport returns ctx which makes the token requests with base, or ctx if base is nil.
+func contextWithTransport(ctx context.Context, base http.RoundTripper) context.Context {
+	if base == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: base})
 }
 
-// newOauthContext returns context.Context with
-// custom http client for withings's access and refresh tokens endpoints.
-func newOauthContext() context.Context {
-	c := &http.Client{Transport: &oauthTransport{}}
-	return context.WithValue(context.Background(), oauth2.HTTPClient, c)
+// NewTokenTransport returns http.RoundTripper for the token endpoint of withings,
+// which rewrites the requests and the responses of oauth2 to withings' ones and sends them with base.
+// http.DefaultTransport is used if base is nil.
+// Use it as the transport of oauth2.HTTPClient when you call oauth2.Config methods by yourself.
+func NewTokenTransport(base http.RoundTripper) http.RoundTripper {
+	return &oauthTransport{base: base}
 }
 
 // oauthTransport is making custom request and response for withings api.
-type oauthTransport struct{}
+type oauthTransport struct {
+	base http.RoundTripper
+}
 
 // RoundTrip customize request and response for withings api.
 func (t *oauthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrip must not modify the request.
+	r = r.Clone(ContextWithAction(r.Context(), RequestTokenA))
 	if err := interceptRequest(r); err != nil {
 		return nil, err
 	}
 
-	res, err := http.DefaultTransport.RoundTrip(r)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(r)
 	if err != nil {
 		return nil, err
 	}
@@ -299,10 +514,14 @@ func interceptRequest(req *http.Request) error {
 		return fmt.Errorf("cannot parse request form: %v", err)
 	}
 
-	req.PostForm.Set("action", "requesttoken")
+	req.PostForm.Set("action", RequestTokenA)
 	encoded := req.PostForm.Encode()
 	req.Body = ioutil.NopCloser(strings.NewReader(encoded))
 	req.ContentLength = int64(len(encoded))
+	// GetBody must return the rewritten body for redirects, retries of the transport and middlewares.
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(encoded)), nil
+	}
 
 	return nil
 }
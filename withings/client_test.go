@@ -0,0 +1,275 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeServer is a fake withings api which serves the token endpoint and the measure api.
+type fakeServer struct {
+	*httptest.Server
+	refreshes int32
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	jsonBlob, err := ioutil.ReadFile(testMeasureFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile returns error(%v)", err)
+	}
+
+	fs := &fakeServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth2", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fs.refreshes, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":0,"body":{"userid":"363","access_token":"access-%d","refresh_token":"refresh-%d","expires_in":10800,"scope":"user.info,user.metrics,user.activity","token_type":"Bearer"}}`, n, n)
+	})
+	mux.HandleFunc("/measure", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("request to %s has no Authorization header", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonBlob)
+	})
+	fs.Server = httptest.NewServer(mux)
+	return fs
+}
+
+// newFakeClient returns client for fs with an expired token.
+func newFakeClient(t *testing.T, fs *fakeServer) *Client {
+	c, err := New("cid", "secret", "http://localhost/callback", WithBaseURL(fs.URL))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	expired := &oauth2.Token{
+		AccessToken:  "expired",
+		RefreshToken: "refresh-0",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+	if err := c.SetToken(expired.WithExtra(map[string]interface{}{"userid": "363"})); err != nil {
+		t.Fatalf("SetToken returns error(%v)", err)
+	}
+	return c
+}
+
+func TestSilentRefreshIsPersisted(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	c := newFakeClient(t, fs)
+	store := NewMemoryTokenStore()
+	c.Store = store
+	var notified *oauth2.Token
+	c.OnTokenRefresh = func(t *oauth2.Token) error {
+		notified = t
+		return nil
+	}
+
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	if notified == nil || notified.AccessToken != "access-1" {
+		t.Fatalf("OnTokenRefresh got %v, want access-1", notified)
+	}
+	if c.Token.AccessToken != "access-1" {
+		t.Errorf("client.Token.AccessToken = %s, want access-1", c.Token.AccessToken)
+	}
+	saved, err := store.Load("363")
+	if err != nil {
+		t.Fatalf("store.Load returns error(%v)", err)
+	}
+	if saved.RefreshToken != "refresh-1" {
+		t.Errorf("saved RefreshToken = %s, want refresh-1", saved.RefreshToken)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	c := newFakeClient(t, fs)
+	c.Store = NewMemoryTokenStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, true, Weight); err != nil {
+				t.Errorf("GetMeas returns error(%v)", err)
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tk, _, err := c.RefreshToken()
+			if err != nil {
+				t.Errorf("RefreshToken returns error(%v)", err)
+				return
+			}
+			if tk.AccessToken != "access-1" {
+				t.Errorf("RefreshToken returns %s, want access-1", tk.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Errorf("token was refreshed %d times, want 1", n)
+	}
+	if tk := c.CurrentToken(); tk.AccessToken != "access-1" {
+		t.Errorf("CurrentToken = %s, want access-1", tk.AccessToken)
+	}
+}
+
+func TestConcurrentSetToken(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	c := newFakeClient(t, fs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			tk := &oauth2.Token{
+				AccessToken:  fmt.Sprintf("set-%d", i),
+				RefreshToken: "refresh",
+				TokenType:    "Bearer",
+				Expiry:       time.Now().Add(time.Hour),
+			}
+			if err := c.SetToken(tk); err != nil {
+				t.Errorf("SetToken returns error(%v)", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+				t.Errorf("GetMeas returns error(%v)", err)
+			}
+			c.HasToken()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSetNilTokenWithStore(t *testing.T) {
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.Store = NewMemoryTokenStore()
+	if err := c.SetToken(nil); err == nil {
+		t.Error("SetToken(nil) returns no error")
+	}
+	if err := c.StoreToken(); err == nil {
+		t.Error("StoreToken without token returns no error")
+	}
+}
+
+// newBlockingServer returns the server which does not respond until the request is canceled.
+func newBlockingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the canceled request after the body is read.
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+}
+
+func TestGetMeasContext(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+	bs := newBlockingServer()
+	defer bs.Close()
+
+	c := newFakeClient(t, fs)
+	c.MeasureURL = bs.URL
+	c.RetryPolicy = NoRetry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetMeasContext(ctx, Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetMeasContext returns error(%v), want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= c.Timeout {
+		t.Errorf("GetMeasContext took %v, want less than Timeout %v", elapsed, c.Timeout)
+	}
+
+	// Client.Timeout is the upper bound for a context without deadline.
+	c.Timeout = 50 * time.Millisecond
+	_, err = c.GetMeasContext(context.Background(), Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetMeasContext returns error(%v), want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRefreshTokenContext(t *testing.T) {
+	bs := newBlockingServer()
+	defer bs.Close()
+
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.Conf.Endpoint.TokenURL = bs.URL
+	c.SetToken(&oauth2.Token{AccessToken: "expired", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, _, err := c.RefreshTokenContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RefreshTokenContext returns error(%v), want context.Canceled", err)
+	}
+	if tk := c.CurrentToken(); tk.AccessToken != "expired" {
+		t.Errorf("CurrentToken = %s, want expired", tk.AccessToken)
+	}
+}
+
+func TestOnTokenRefreshFailure(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	c := newFakeClient(t, fs)
+	failed := errors.New("failed")
+	var calls []string
+	c.OnTokenRefresh = func(t *oauth2.Token) error {
+		calls = append(calls, t.AccessToken)
+		if len(calls) == 1 {
+			return failed
+		}
+		return nil
+	}
+
+	if _, _, err := c.RefreshToken(); !errors.Is(err, failed) {
+		t.Fatalf("RefreshToken returns error(%v), want %v", err, failed)
+	}
+	// The refreshed token is handled again without another refresh.
+	if _, _, err := c.RefreshToken(); err != nil {
+		t.Fatalf("RefreshToken returns error(%v)", err)
+	}
+	if len(calls) != 2 || calls[0] != "access-1" || calls[1] != "access-1" {
+		t.Errorf("OnTokenRefresh was called with %v, want [access-1 access-1]", calls)
+	}
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Errorf("token was refreshed %d times, want 1", n)
+	}
+}
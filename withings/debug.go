@@ -0,0 +1,160 @@
+package withings
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zono-dev/withings-go/withings/internal/redact"
+)
+
+// DebugOptions configures the debug dump of HTTP traffic. See WithDebug.
+type DebugOptions struct {
+	// Writer receives the dumps as text. If nil, they are logged at debug level to Logger.
+	Writer io.Writer
+	// Logger receives the dumps if Writer is nil. Client.Logger is used if both are nil.
+	Logger *slog.Logger
+	// ShowUserID keeps userids in the dumps. Tokens, the client secret and authorization codes are always redacted.
+	ShowUserID bool
+}
+
+// WithDebug dumps every request to withings and its response, including token requests,
+// with the secrets redacted. Responses are read into memory to be dumped, so do not use it for large responses in production.
+func WithDebug(opts DebugOptions) ClientOption {
+	return func(c *Client) error {
+		c.Use(debugMiddleware(opts, c.logger))
+		return nil
+	}
+}
+
+// DebugMiddleware returns the middleware of WithDebug, e.g. for the base transport of NewTokenTransport.
+func DebugMiddleware(opts DebugOptions) Middleware {
+	return debugMiddleware(opts, func() *slog.Logger { return discardLogger })
+}
+
+func debugMiddleware(opts DebugOptions, fallback func() *slog.Logger) Middleware {
+	d := &debugDumper{opts: opts, fallback: fallback}
+	if opts.ShowUserID {
+		d.redactor.Keep = []string{"userid"}
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return d.roundTrip(next, req)
+		})
+	}
+}
+
+type debugDumper struct {
+	opts     DebugOptions
+	fallback func() *slog.Logger
+	redactor redact.Redactor
+
+	// mu serializes the dumps to Writer.
+	mu sync.Mutex
+}
+
+func (d *debugDumper) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	action := ActionFromContext(req.Context())
+	reqBody, err := d.requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	d.dump(req, action, "request", fmt.Sprintf("%s %s", req.Method, d.redactor.URL(req.URL)), req.Header, reqBody)
+
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		d.dumpError(req, action, err, time.Since(start))
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		d.dumpError(req, action, err, time.Since(start))
+		return nil, err
+	}
+	d.dump(req, action, "response", fmt.Sprintf("%s (%v)", resp.Status, time.Since(start).Round(time.Millisecond)), resp.Header, respBody)
+	return resp, nil
+}
+
+// requestBody returns the body of req without consuming it.
+func (d *debugDumper) requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// dump writes the redacted request or response. The body is redacted whatever its Content-Type is.
+func (d *debugDumper) dump(req *http.Request, action, kind, line string, header http.Header, body []byte) {
+	body = d.redactor.Body(body)
+	header = redact.Header(header)
+
+	if d.opts.Writer == nil {
+		d.logger().DebugContext(req.Context(), "withings "+kind, "action", action, kind, line, "body", string(body))
+		return
+	}
+
+	var b strings.Builder
+	arrow := "-->"
+	if kind == "response" {
+		arrow = "<--"
+	}
+	fmt.Fprintf(&b, "%s %s [%s]\n", arrow, line, action)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", k, strings.Join(header[k], ", "))
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	b.WriteString("\n")
+	d.write(b.String())
+}
+
+func (d *debugDumper) dumpError(req *http.Request, action string, err error, elapsed time.Duration) {
+	if d.opts.Writer == nil {
+		d.logger().DebugContext(req.Context(), "withings request failed", "action", action, "error", err, "duration", elapsed)
+		return
+	}
+	d.write(fmt.Sprintf("<-- error (%v) [%s]: %v\n\n", elapsed.Round(time.Millisecond), action, err))
+}
+
+func (d *debugDumper) write(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	io.WriteString(d.opts.Writer, s)
+}
+
+func (d *debugDumper) logger() *slog.Logger {
+	if d.opts.Logger != nil {
+		return d.opts.Logger
+	}
+	return d.fallback()
+}
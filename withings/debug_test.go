@@ -0,0 +1,97 @@
+package withings
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithDebug(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	var buf bytes.Buffer
+	c := newFakeClient(t, fs)
+	if err := WithDebug(DebugOptions{Writer: &buf})(c); err != nil {
+		t.Fatalf("WithDebug returns error(%v)", err)
+	}
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"--> POST", "<-- 200 OK", "[requesttoken]", "[getmeas]", "action=requesttoken", "grant_type=refresh_token", "meastype=1", `"measuregrps"`, "REDACTED"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump does not have %q:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{"=secret", "refresh-0", "access-1", "refresh-1", "expired", `"363"`} {
+		if strings.Contains(out, secret) {
+			t.Errorf("dump has %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestWithDebugLogger(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	var buf bytes.Buffer
+	c := newFakeClient(t, fs)
+	c.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := WithDebug(DebugOptions{ShowUserID: true})(c); err != nil {
+		t.Fatalf("WithDebug returns error(%v)", err)
+	}
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{`msg="withings request" action=requesttoken`, `msg="withings response" action=getmeas`, `\"userid\":\"363\"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log does not have %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "access-1") || strings.Contains(out, "refresh-0") {
+		t.Errorf("log has the token:\n%s", out)
+	}
+}
+
+func TestWithDebugContentType(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth2", func(w http.ResponseWriter, r *http.Request) {
+		// The server controls Content-Type, so it must not decide what is redacted.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.WriteString(w, `{"status":0,"body":{"userid":"363","access_token":"access-1","refresh_token":"refresh-1","expires_in":10800,"scope":"user.metrics","token_type":"Bearer"}}`)
+	})
+	mux.HandleFunc("/measure", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(largeMeasurePayload(1))
+	})
+	fs := &fakeServer{Server: httptest.NewServer(mux)}
+	defer fs.Close()
+
+	var buf bytes.Buffer
+	c := newFakeClient(t, fs)
+	if err := WithDebug(DebugOptions{Writer: &buf})(c); err != nil {
+		t.Fatalf("WithDebug returns error(%v)", err)
+	}
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `"access_token":"REDACTED"`) {
+		t.Errorf("dump does not have the redacted token:\n%s", out)
+	}
+	for _, secret := range []string{"access-1", "refresh-1", "refresh-0", `"363"`} {
+		if strings.Contains(out, secret) {
+			t.Errorf("dump has %q:\n%s", secret, out)
+		}
+	}
+}
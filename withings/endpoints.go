@@ -0,0 +1,121 @@
+package withings
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Endpoints is the URLs of withings which the client accesses.
+type Endpoints struct {
+	// AuthURL is the URL to authorize the app.
+	AuthURL string
+	// TokenURL is the URL to exchange the grant code and to refresh the token.
+	TokenURL string
+	// MeasureURL is the URL of Measure api (GetMeas).
+	MeasureURL string
+	// MeasureURLv2 is the URL of Measure v2 api (GetActivity, GetWorkouts).
+	MeasureURLv2 string
+	// SleepURLv2 is the URL of Sleep v2 api (GetSleep, GetSleepSummary).
+	SleepURLv2 string
+}
+
+// DefaultEndpoints is the endpoints of withings.
+var DefaultEndpoints = Endpoints{
+	AuthURL:      defaultAuthURL,
+	TokenURL:     defaultTokenURL,
+	MeasureURL:   defaultMeasureURL,
+	MeasureURLv2: defaultMeasureURLv2,
+	SleepURLv2:   defaultSleepURLv2,
+}
+
+// EndpointsFromBaseURL returns the endpoints of the api and the token on baseURL instead of https://wbsapi.withings.net.
+// AuthURL is the default one since it is on another host.
+func EndpointsFromBaseURL(baseURL string) (Endpoints, error) {
+	if err := checkEndpointURL("base url", baseURL); err != nil {
+		return Endpoints{}, err
+	}
+	base := strings.TrimSuffix(baseURL, "/")
+	return Endpoints{
+		AuthURL:      defaultAuthURL,
+		TokenURL:     base + "/v2/oauth2",
+		MeasureURL:   base + "/measure",
+		MeasureURLv2: base + "/v2/measure",
+		SleepURLv2:   base + "/v2/sleep",
+	}, nil
+}
+
+// withDefaults returns e whose empty URLs are replaced with DefaultEndpoints.
+func (e Endpoints) withDefaults() Endpoints {
+	def := DefaultEndpoints
+	for _, f := range []struct{ v, d *string }{
+		{&e.AuthURL, &def.AuthURL},
+		{&e.TokenURL, &def.TokenURL},
+		{&e.MeasureURL, &def.MeasureURL},
+		{&e.MeasureURLv2, &def.MeasureURLv2},
+		{&e.SleepURLv2, &def.SleepURLv2},
+	} {
+		if *f.v == "" {
+			*f.v = *f.d
+		}
+	}
+	return e
+}
+
+// Validate checks that all URLs are absolute http(s) URLs.
+func (e Endpoints) Validate() error {
+	for _, f := range []struct{ name, u string }{
+		{"auth url", e.AuthURL},
+		{"token url", e.TokenURL},
+		{"measure url", e.MeasureURL},
+		{"measure v2 url", e.MeasureURLv2},
+		{"sleep v2 url", e.SleepURLv2},
+	} {
+		if err := checkEndpointURL(f.name, f.u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkEndpointURL(name, s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("%s %q is not an absolute http(s) url", name, s)
+	}
+	return nil
+}
+
+// Endpoints returns the endpoints of the client.
+func (c *Client) Endpoints() Endpoints {
+	return Endpoints{
+		AuthURL:      c.Conf.Endpoint.AuthURL,
+		TokenURL:     c.Conf.Endpoint.TokenURL,
+		MeasureURL:   c.MeasureURL,
+		MeasureURLv2: c.MeasureURLv2,
+		SleepURLv2:   c.SleepURLv2,
+	}
+}
+
+// SetEndpoints sets the endpoints of the client including the OAuth URLs of Conf.
+// Empty URLs in e are the default ones.
+func (c *Client) SetEndpoints(e Endpoints) error {
+	e = e.withDefaults()
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	c.Conf.Endpoint.AuthURL = e.AuthURL
+	c.Conf.Endpoint.TokenURL = e.TokenURL
+	c.MeasureURL = e.MeasureURL
+	c.MeasureURLv2 = e.MeasureURLv2
+	c.SleepURLv2 = e.SleepURLv2
+	return nil
+}
+
+// WithEndpoints sets the endpoints of the client. See Client.SetEndpoints.
+func WithEndpoints(e Endpoints) ClientOption {
+	return func(c *Client) error {
+		return c.SetEndpoints(e)
+	}
+}
@@ -0,0 +1,82 @@
+package withings
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDefaultEndpoints(t *testing.T) {
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	if got := c.Endpoints(); got != DefaultEndpoints {
+		t.Errorf("Endpoints = %+v, want %+v", got, DefaultEndpoints)
+	}
+	if err := DefaultEndpoints.Validate(); err != nil {
+		t.Errorf("Validate returns error(%v)", err)
+	}
+	for _, u := range []string{DefaultEndpoints.AuthURL, DefaultEndpoints.TokenURL} {
+		if !strings.HasPrefix(u, "https://") {
+			t.Errorf("%s is not https", u)
+		}
+	}
+}
+
+func TestWithEndpoints(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	// Empty URLs are the default ones.
+	c, err := New("cid", "secret", "http://localhost/callback", WithEndpoints(Endpoints{
+		TokenURL:   fs.URL + "/v2/oauth2",
+		MeasureURL: fs.URL + "/measure",
+	}))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	e := c.Endpoints()
+	if e.AuthURL != DefaultEndpoints.AuthURL || e.SleepURLv2 != DefaultEndpoints.SleepURLv2 || e.TokenURL != fs.URL+"/v2/oauth2" {
+		t.Errorf("Endpoints = %+v", e)
+	}
+
+	authURL, _, err := AuthCodeURL(c.Conf)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returns error(%v)", err)
+	}
+	if !strings.HasPrefix(authURL, DefaultEndpoints.AuthURL+"?") {
+		t.Errorf("AuthCodeURL = %s, want %s", authURL, DefaultEndpoints.AuthURL)
+	}
+
+	// The token refresh and the api call go to the server.
+	c.SetToken(newFakeClient(t, fs).CurrentToken())
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Errorf("token was refreshed %d times, want 1", n)
+	}
+
+	if _, err := New("cid", "secret", "http://localhost/callback", WithEndpoints(Endpoints{MeasureURL: "localhost:8080"})); err == nil {
+		t.Error("New returns no error for invalid measure url")
+	}
+}
+
+func TestEndpointsFromBaseURL(t *testing.T) {
+	e, err := EndpointsFromBaseURL("http://localhost:8080/withings/")
+	if err != nil {
+		t.Fatalf("EndpointsFromBaseURL returns error(%v)", err)
+	}
+	want := Endpoints{
+		AuthURL:      DefaultEndpoints.AuthURL,
+		TokenURL:     "http://localhost:8080/withings/v2/oauth2",
+		MeasureURL:   "http://localhost:8080/withings/measure",
+		MeasureURLv2: "http://localhost:8080/withings/v2/measure",
+		SleepURLv2:   "http://localhost:8080/withings/v2/sleep",
+	}
+	if e != want {
+		t.Errorf("EndpointsFromBaseURL = %+v, want %+v", e, want)
+	}
+}
@@ -2,6 +2,8 @@ package withings
 
 // API endpoint
 const (
+	defaultAuthURL      = "https://account.withings.com/oauth2_user/authorize2"
+	defaultTokenURL     = "https://wbsapi.withings.net/v2/oauth2"
 	defaultMeasureURL   = "https://wbsapi.withings.net/measure"
 	defaultMeasureURLv2 = "https://wbsapi.withings.net/v2/measure"
 	defaultSleepURLv2   = "https://wbsapi.withings.net/v2/sleep"
@@ -9,9 +11,10 @@ const (
 
 // scopes
 const (
-	ScopeActivity string = "user.activity"
-	ScopeMetrics  string = "user.metrics"
-	ScopeInfo     string = "user.info"
+	ScopeActivity    Scope = "user.activity"
+	ScopeMetrics     Scope = "user.metrics"
+	ScopeInfo        Scope = "user.info"
+	ScopeSleepEvents Scope = "user.sleepevents"
 )
 
 // form keys
@@ -35,6 +38,8 @@ const (
 	WorkoutsA string = "getworkouts"
 	SleepA    string = "get"
 	SleepSA   string = "getsummary"
+	// RequestTokenA is the action of the token requests.
+	RequestTokenA string = "requesttoken"
 )
 
 // MeasType is Measurement Type
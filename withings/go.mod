@@ -1,9 +1,19 @@
 module github.com/zono-dev/withings-go/withings
 
-go 1.15
+go 1.24
 
 require (
 	github.com/pkg/errors v0.9.1
 	golang.org/x/oauth2 v0.0.0-20201208152858-08078c50e5b5
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/kr/pretty v0.3.1 // indirect
+	github.com/rogpeppe/go-internal v1.13.1 // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	google.golang.org/appengine v1.6.6 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
+)
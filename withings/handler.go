@@ -0,0 +1,121 @@
+package withings
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// defaultStateCookie is the default name of the cookie which keeps the state.
+const defaultStateCookie = "withings_oauth_state"
+
+// stateCookieMaxAge is how long the state is kept in seconds.
+const stateCookieMaxAge = 10 * 60
+
+// AuthHandler provides the withings authorization flow as http.Handlers for web apps.
+// StartHandler redirects to the URL to authorize with a generated state, which is kept in a cookie,
+// and CallbackHandler, served at Conf.RedirectURL, verifies the state and exchanges the grant code for a token.
+type AuthHandler struct {
+	Conf *oauth2.Config
+	// Store saves the token under its userid if it is set.
+	Store TokenStore
+	// OnToken is called with the authorized token and should write the response.
+	// A plain text message is written if OnToken is nil.
+	OnToken func(w http.ResponseWriter, r *http.Request, userid string, token *oauth2.Token)
+	// OnError is called when the authorization failed with the status code to respond.
+	// http.Error is used if OnError is nil.
+	OnError func(w http.ResponseWriter, r *http.Request, status int, err error)
+	// CookieName is the name of the state cookie. "withings_oauth_state" is used if empty.
+	CookieName string
+	// Transport is the base transport of the token exchange. http.DefaultTransport is used if nil.
+	Transport http.RoundTripper
+}
+
+func (h *AuthHandler) cookieName() string {
+	if h.CookieName != "" {
+		return h.CookieName
+	}
+	return defaultStateCookie
+}
+
+func (h *AuthHandler) secure(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(h.Conf.RedirectURL, "https://")
+}
+
+func (h *AuthHandler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.OnError != nil {
+		h.OnError(w, r, status, err)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// StartHandler returns http.Handler which redirects to the URL to authorize.
+func (h *AuthHandler) StartHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authURL, state, err := AuthCodeURL(h.Conf)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.cookieName(),
+			Value:    state,
+			Path:     "/",
+			MaxAge:   stateCookieMaxAge,
+			HttpOnly: true,
+			Secure:   h.secure(r),
+			// withings redirects back with a top level GET, so Lax is enough.
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// CallbackHandler returns http.Handler for the redirect from withings.
+func (h *AuthHandler) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state string
+		if c, err := r.Cookie(h.cookieName()); err == nil {
+			state = c.Value
+		}
+		// The state can be used only once.
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.cookieName(),
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   h.secure(r),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		token, err := ExchangeCallback(contextWithTransport(r.Context(), h.Transport), h.Conf, state, r.URL.Query())
+		if err != nil {
+			status := http.StatusBadRequest
+			var rerr *oauth2.RetrieveError
+			if errors.As(err, &rerr) {
+				status = http.StatusBadGateway
+			}
+			h.fail(w, r, status, err)
+			return
+		}
+
+		userid := TokenUserID(token)
+		if h.Store != nil {
+			if err := h.Store.Save(userid, token); err != nil {
+				h.fail(w, r, http.StatusInternalServerError, fmt.Errorf("cannot save token: %w", err))
+				return
+			}
+		}
+
+		if h.OnToken != nil {
+			h.OnToken(w, r, userid, token)
+			return
+		}
+		fmt.Fprintln(w, "Authorization completed.")
+	})
+}
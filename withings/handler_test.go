@@ -0,0 +1,111 @@
+package withings
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// newAuthHandlerServer returns a web app serving AuthHandler at /start and /callback.
+func newAuthHandlerServer(t *testing.T, store TokenStore) (*httptest.Server, *http.Client) {
+	ts := newTokenServer(t)
+	t.Cleanup(ts.Close)
+
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+
+	conf := GetNewConf("cid", "secret", app.URL+"/callback")
+	conf.Endpoint.TokenURL = ts.URL
+	h := &AuthHandler{
+		Conf:  &conf,
+		Store: store,
+		OnToken: func(w http.ResponseWriter, r *http.Request, userid string, token *oauth2.Token) {
+			w.Write([]byte(userid))
+		},
+	}
+	mux.Handle("/start", h.StartHandler())
+	mux.Handle("/callback", h.CallbackHandler())
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{
+		Jar: jar,
+		// do not follow the redirect to withings
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return app, browser
+}
+
+// start calls /start and returns the state in the URL to authorize.
+func start(t *testing.T, app *httptest.Server, browser *http.Client) string {
+	res, err := browser.Get(app.URL + "/start")
+	if err != nil {
+		t.Fatalf("GET /start returns error(%v)", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("GET /start status = %d, want %d", res.StatusCode, http.StatusFound)
+	}
+	u, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("cannot parse Location: %v", err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestAuthHandler(t *testing.T) {
+	store := NewMemoryTokenStore()
+	app, browser := newAuthHandlerServer(t, store)
+
+	state := start(t, app, browser)
+	res, err := browser.Get(app.URL + "/callback?code=grant&state=" + url.QueryEscape(state))
+	if err != nil {
+		t.Fatalf("GET /callback returns error(%v)", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET /callback status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	token, err := store.Load("363")
+	if err != nil {
+		t.Fatalf("token was not saved: %v", err)
+	}
+	if token.AccessToken != "access-authorization_code" {
+		t.Errorf("AccessToken = %s, want access-authorization_code", token.AccessToken)
+	}
+
+	// the state cannot be used twice
+	res, err = browser.Get(app.URL + "/callback?code=grant&state=" + url.QueryEscape(state))
+	if err != nil {
+		t.Fatalf("GET /callback returns error(%v)", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /callback with used state status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestAuthHandlerForgedState(t *testing.T) {
+	store := NewMemoryTokenStore()
+	app, browser := newAuthHandlerServer(t, store)
+
+	start(t, app, browser)
+	res, err := browser.Get(app.URL + "/callback?code=grant&state=forged")
+	if err != nil {
+		t.Fatalf("GET /callback returns error(%v)", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /callback status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+	if _, err := store.Load("363"); err != ErrTokenNotFound {
+		t.Errorf("token was saved with forged state")
+	}
+}
@@ -0,0 +1,39 @@
+// Package fakeapi is a fake withings api for the tests of the integrations.
+package fakeapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// NewServer returns a fake withings api which serves the token and measure endpoints
+// under the base URL of withings.WithBaseURL. The measure apis return status for the first failures requests.
+func NewServer(status, failures int) *httptest.Server {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/oauth2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":0,"body":{"userid":"363","access_token":"access-1","refresh_token":"refresh-1","expires_in":10800,"scope":"user.metrics","token_type":"Bearer"}}`)
+	})
+	measure := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		failed := requests <= failures
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if failed {
+			fmt.Fprintf(w, `{"status":%d,"body":{},"error":"failed"}`, status)
+			return
+		}
+		fmt.Fprint(w, `{"status":0,"body":{"updatetime":1594857600,"timezone":"Asia/Tokyo","measuregrps":[]}}`)
+	}
+	mux.HandleFunc("/measure", measure)
+	mux.HandleFunc("/v2/measure", measure)
+	return httptest.NewServer(mux)
+}
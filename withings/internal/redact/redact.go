@@ -0,0 +1,173 @@
+// Package redact removes secrets of withings requests and responses,
+// e.g. for recorded cassettes and debug dumps.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the secret values.
+const Redacted = "REDACTED"
+
+// sensitiveKeys are the form params and the json keys which have secrets.
+var sensitiveKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"csrf_token":    true,
+	"client_secret": true,
+	"code":          true,
+	"userid":        true,
+	"signature":     true,
+	"nonce":         true,
+}
+
+// sensitiveHeaders are the headers which have secrets.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// IsSensitive reports whether the form param or the json key has a secret.
+func IsSensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// Redactor redacts the sensitive values except the keys in Keep.
+// The zero Redactor is what the functions of the package use.
+type Redactor struct {
+	// Keep are the sensitive keys which are not redacted, e.g. "userid".
+	Keep []string
+}
+
+func (r Redactor) redacts(key string) bool {
+	if !IsSensitive(key) {
+		return false
+	}
+	for _, k := range r.Keep {
+		if strings.EqualFold(k, key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Header returns a copy of h whose sensitive headers are redacted.
+func Header(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range sensitiveHeaders {
+		if _, ok := h[k]; ok {
+			h.Set(k, Redacted)
+		}
+	}
+	return h
+}
+
+// Form returns a copy of v whose sensitive params are redacted.
+func Form(v url.Values) url.Values { return Redactor{}.Form(v) }
+
+// Form returns a copy of v whose sensitive params are redacted.
+func (r Redactor) Form(v url.Values) url.Values {
+	out := url.Values{}
+	for k, vs := range v {
+		if r.redacts(k) {
+			out[k] = []string{Redacted}
+			continue
+		}
+		out[k] = append([]string(nil), vs...)
+	}
+	return out
+}
+
+// URL returns a copy of u whose sensitive query params are redacted.
+func URL(u *url.URL) *url.URL { return Redactor{}.URL(u) }
+
+// URL returns a copy of u whose sensitive query params are redacted.
+func (r Redactor) URL(u *url.URL) *url.URL {
+	u2 := *u
+	if u.RawQuery != "" {
+		u2.RawQuery = r.Form(u.Query()).Encode()
+	}
+	u2.User = nil
+	return &u2
+}
+
+// FormBody redacts the url-encoded body. The body is returned as it is if it cannot be parsed.
+func FormBody(b []byte) []byte { return Redactor{}.FormBody(b) }
+
+// FormBody redacts the url-encoded body. The body is returned as it is if it cannot be parsed.
+func (r Redactor) FormBody(b []byte) []byte {
+	v, err := url.ParseQuery(string(b))
+	if err != nil {
+		return b
+	}
+	return []byte(r.Form(v).Encode())
+}
+
+// JSON redacts the values of the sensitive keys in the json at any depth.
+// The json is returned as it is if it cannot be parsed. Numbers are kept as they are.
+func JSON(b []byte) []byte { return Redactor{}.JSON(b) }
+
+// JSON redacts the values of the sensitive keys in the json at any depth.
+// The json is returned as it is if it cannot be parsed. Numbers are kept as they are.
+func (r Redactor) JSON(b []byte) []byte {
+	out, _ := r.json(b)
+	return out
+}
+
+// json is JSON which also reports whether b is json.
+func (r Redactor) json(b []byte) ([]byte, bool) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return b, false
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return b, false
+	}
+	return out, true
+}
+
+func (r Redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, e := range val {
+			if r.redacts(k) {
+				val[k] = Redacted
+				continue
+			}
+			val[k] = r.redactValue(e)
+		}
+	case []interface{}:
+		for i, e := range val {
+			val[i] = r.redactValue(e)
+		}
+	}
+	return v
+}
+
+// Body redacts the body whatever its content type claims, since the server controls the header.
+// The body is redacted as json if it is json, or else as a url-encoded form if it has sensitive params.
+// Other bodies are returned as they are.
+func Body(b []byte) []byte { return Redactor{}.Body(b) }
+
+// Body redacts the body whatever its content type claims, since the server controls the header.
+// The body is redacted as json if it is json, or else as a url-encoded form if it has sensitive params.
+// Other bodies are returned as they are.
+func (r Redactor) Body(b []byte) []byte {
+	if out, ok := r.json(b); ok {
+		return out
+	}
+	v, err := url.ParseQuery(string(b))
+	if err != nil {
+		return b
+	}
+	for k := range v {
+		if r.redacts(k) {
+			return []byte(r.Form(v).Encode())
+		}
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	in := `{"status":0,"body":{"userid":12345678,"access_token":"secret-a","refresh_token":"secret-r","csrf_token":"secret-c","expires_in":10800,"series":[{"userid":"42","steps":100}]}}`
+	out := string(JSON([]byte(in)))
+	for _, secret := range []string{"12345678", "secret-a", "secret-r", "secret-c", `"42"`} {
+		if strings.Contains(out, secret) {
+			t.Errorf("JSON(%s) = %s, has %s", in, out, secret)
+		}
+	}
+	for _, kept := range []string{`"expires_in":10800`, `"steps":100`, `"status":0`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("JSON(%s) = %s, want %s", in, out, kept)
+		}
+	}
+	if got := string(JSON([]byte("not json"))); got != "not json" {
+		t.Errorf("JSON(not json) = %s", got)
+	}
+}
+
+func TestForm(t *testing.T) {
+	v := url.Values{"client_secret": {"s"}, "code": {"c"}, "action": {"getmeas"}}
+	got := Form(v)
+	if got.Get("client_secret") != Redacted || got.Get("code") != Redacted || got.Get("action") != "getmeas" {
+		t.Errorf("Form = %v", got)
+	}
+	if v.Get("client_secret") != "s" {
+		t.Error("Form modified the argument")
+	}
+
+	u, _ := url.Parse("https://example.com/callback?code=c&state=s")
+	if got := URL(u).String(); got != "https://example.com/callback?code=REDACTED&state=s" {
+		t.Errorf("URL = %s", got)
+	}
+	if got := string(Body([]byte("refresh_token=r&grant_type=refresh_token"))); got != "grant_type=refresh_token&refresh_token=REDACTED" {
+		t.Errorf("Body = %s", got)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{"Authorization": {"Bearer token"}, "Content-Type": {"application/json"}}
+	got := Header(h)
+	if got.Get("Authorization") != Redacted || got.Get("Content-Type") != "application/json" {
+		t.Errorf("Header = %v", got)
+	}
+	if h.Get("Authorization") != "Bearer token" {
+		t.Error("Header modified the argument")
+	}
+}
+
+func TestRedactorKeep(t *testing.T) {
+	r := Redactor{Keep: []string{"userid"}}
+	out := string(r.JSON([]byte(`{"body":{"userid":"42","access_token":"secret-a"}}`)))
+	if !strings.Contains(out, `"userid":"42"`) || strings.Contains(out, "secret-a") {
+		t.Errorf("JSON = %s, want userid kept and access_token redacted", out)
+	}
+	got := r.Form(url.Values{"userid": {"42"}, "code": {"c"}})
+	if got.Get("userid") != "42" || got.Get("code") != Redacted {
+		t.Errorf("Form = %v", got)
+	}
+}
+
+func TestBody(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`{"body":{"access_token":"a"}}`, `{"body":{"access_token":"REDACTED"}}`},
+		{"code=c&state=s", "code=REDACTED&state=s"},
+		// Bodies without secrets are kept as they are.
+		{"action=getmeas&meastype=1", "action=getmeas&meastype=1"},
+		{"Bad Gateway", "Bad Gateway"},
+	}
+	for _, c := range cases {
+		if got := string(Body([]byte(c.in))); got != c.want {
+			t.Errorf("Body(%s) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package withings
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// LoopbackAuthorizer provides oauth2 authorization for withings without copying the grant code by hand.
+// It starts a temporary HTTP server on the host and port of Conf.RedirectURL,
+// opens the URL to authorize and waits for withings to redirect the browser back with the grant code.
+// Conf.RedirectURL must point to this machine (e.g. http://localhost:8080/callback)
+// and must be registered as a callback URL of your withings app.
+type LoopbackAuthorizer struct {
+	Conf *oauth2.Config
+	// Timeout is the maximum time to wait for the redirect. Zero means no timeout.
+	Timeout time.Duration
+	// OpenURL opens the URL to authorize. OpenBrowser is used if nil.
+	OpenURL func(url string) error
+	// Transport is the base transport of the token exchange. http.DefaultTransport is used if nil.
+	Transport http.RoundTripper
+	// Out receives the URL to authorize and the messages for the user. Nothing is written if nil,
+	// so Authorize fails if the URL cannot be opened.
+	Out io.Writer
+}
+
+// AuthorizeLoopback provides oauth2 authorization for withings with a temporary local HTTP server.
+// See LoopbackAuthorizer to know the detail.
+func AuthorizeLoopback(ctx context.Context, conf *oauth2.Config, timeout time.Duration) (*oauth2.Token, error) {
+	a := &LoopbackAuthorizer{Conf: conf, Timeout: timeout}
+	return a.Authorize(ctx)
+}
+
+// Authorize waits for the grant code and exchanges it for a token.
+func (a *LoopbackAuthorizer) Authorize(ctx context.Context) (*oauth2.Token, error) {
+	u, err := url.Parse(a.Conf.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse redirect url: %v", err)
+	}
+	if u.Scheme != "http" {
+		return nil, errors.Errorf("loopback authorization needs http redirect url, got %q", a.Conf.RedirectURL)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	ln, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %s: %v", host, err)
+	}
+
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	authURL, state, err := AuthCodeURL(a.Conf)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	queryc := make(chan url.Values, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("error") == "" && q.Get("code") == "" {
+			// favicon and the like
+			http.NotFound(w, r)
+			return
+		}
+		// Ignore forged requests and keep waiting for the right one.
+		if err := VerifyState(state, q.Get("state")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case queryc <- q:
+		default:
+		}
+
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "Authorization failed: "+e, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, "Authorization completed. You can close this window.")
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+
+	if a.Out != nil {
+		fmt.Fprintf(a.Out, "URL to authorize:%s\n", authURL)
+	}
+
+	open := a.OpenURL
+	if open == nil {
+		open = OpenBrowser
+	}
+	if err := open(authURL); err != nil {
+		if a.Out == nil {
+			// The server may not have started serving ln yet, so close it here.
+			ln.Close()
+			return nil, errors.Wrap(err, "cannot open the URL to authorize")
+		}
+		fmt.Fprintf(a.Out, "Failed to open browser(%v). Open url your browser.\n", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case q := <-queryc:
+		return ExchangeCallback(contextWithTransport(ctx, a.Transport), a.Conf, state, q)
+	}
+}
+
+// OpenBrowser opens url in the default browser.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,179 @@
+package withings
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTokenServer returns a fake withings token endpoint which checks the rewritten request.
+// It rejects the grant code "bad".
+func newTokenServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				t.Errorf("ParseForm returns error(%v)", err)
+			}
+			if r.PostForm.Get("action") != "requesttoken" {
+				t.Errorf("action = %s, want requesttoken", r.PostForm.Get("action"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if r.PostForm.Get("code") == "bad" {
+				fmt.Fprint(w, `{"status":503,"body":{},"error":"Invalid Params: invalid code"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"status":0,"body":{"userid":"363","access_token":"access-%s","refresh_token":"refresh","expires_in":10800,"scope":"user.info,user.metrics","token_type":"Bearer"}}`,
+				r.PostForm.Get("grant_type"))
+		}))
+}
+
+// freeLoopbackURL returns redirect url on a free local port.
+func freeLoopbackURL(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen returns error(%v)", err)
+	}
+	defer ln.Close()
+	return "http://" + ln.Addr().String() + "/callback"
+}
+
+func TestAuthorizeLoopback(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	conf := GetNewConf("cid", "secret", freeLoopbackURL(t))
+	conf.Endpoint.TokenURL = ts.URL
+
+	a := &LoopbackAuthorizer{
+		Conf:    &conf,
+		Timeout: 5 * time.Second,
+		OpenURL: func(authURL string) error {
+			u, err := url.Parse(authURL)
+			if err != nil {
+				return err
+			}
+			// act as the browser redirected by withings
+			go func() {
+				res, err := http.Get(conf.RedirectURL + "?code=grant&state=" + u.Query().Get("state"))
+				if err != nil {
+					t.Errorf("http.Get returns error(%v)", err)
+					return
+				}
+				res.Body.Close()
+			}()
+			return nil
+		},
+	}
+
+	token, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("Authorize returns error(%v)", err)
+	}
+	if token.AccessToken != "access-authorization_code" {
+		t.Errorf("AccessToken = %s, want access-authorization_code", token.AccessToken)
+	}
+}
+
+func TestAuthorizeLoopbackTimeout(t *testing.T) {
+	conf := GetNewConf("cid", "secret", freeLoopbackURL(t))
+	a := &LoopbackAuthorizer{
+		Conf:    &conf,
+		Timeout: 100 * time.Millisecond,
+		OpenURL: func(string) error { return nil },
+	}
+
+	if _, err := a.Authorize(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("Authorize returns error(%v), want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAuthorizeLoopbackOut(t *testing.T) {
+	conf := GetNewConf("cid", "secret", freeLoopbackURL(t))
+	a := &LoopbackAuthorizer{
+		Conf:    &conf,
+		Timeout: 100 * time.Millisecond,
+		OpenURL: func(string) error { return errors.New("no browser") },
+	}
+
+	// Nobody can see the URL to authorize.
+	if _, err := a.Authorize(context.Background()); err == nil || !strings.Contains(err.Error(), "no browser") {
+		t.Errorf("Authorize returns error(%v), want the error of OpenURL", err)
+	}
+
+	var out bytes.Buffer
+	a.Out = &out
+	if _, err := a.Authorize(context.Background()); err != context.DeadlineExceeded {
+		t.Errorf("Authorize returns error(%v), want %v", err, context.DeadlineExceeded)
+	}
+	if !strings.Contains(out.String(), "URL to authorize:"+conf.Endpoint.AuthURL) || !strings.Contains(out.String(), "no browser") {
+		t.Errorf("Out = %q, want the URL to authorize and the error", out.String())
+	}
+}
+
+func TestAuthorizeInteractive(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	conf := GetNewConf("cid", "secret", "https://example.com/callback")
+	conf.Endpoint.TokenURL = ts.URL
+
+	pr, pw := io.Pipe()
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		token, err := AuthorizeInteractive(context.Background(), &conf, pr, &out)
+		if err == nil && token.AccessToken != "access-authorization_code" {
+			err = fmt.Errorf("AccessToken = %s, want access-authorization_code", token.AccessToken)
+		}
+		done <- err
+	}()
+
+	// act as the user who pastes the redirected URL
+	var state string
+	for deadline := time.Now().Add(5 * time.Second); state == "" && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s := out.String()
+		i := strings.Index(s, "URL to authorize:")
+		j := strings.Index(s, "\n")
+		if i < 0 || j < 0 {
+			continue
+		}
+		u, err := url.Parse(s[i+len("URL to authorize:") : j])
+		if err != nil {
+			t.Fatalf("cannot parse the URL to authorize: %v", err)
+		}
+		state = u.Query().Get("state")
+	}
+	fmt.Fprintf(pw, "https://example.com/callback?code=grant&state=%s\n", state)
+
+	if err := <-done; err != nil {
+		t.Errorf("AuthorizeInteractive returns error(%v)", err)
+	}
+}
+
+// syncBuffer is bytes.Buffer which is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
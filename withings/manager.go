@@ -0,0 +1,191 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// Manager holds one authorized client per withings userid for an app.
+// Clients are created on demand from the tokens in the token store, which should be able to keep
+// several users' tokens (e.g. DirTokenStore, not FileTokenStore).
+// Manager is safe for concurrent use.
+type Manager struct {
+	cid         string
+	secret      string
+	redirectURL string
+	store       TokenStore
+	options     []ClientOption
+
+	// RateLimiter is shared by all clients of the manager unless WithRateLimiter is passed to NewManager.
+	// It limits the app to DefaultAppLimit by default. Set it before the clients are created, or set nil not to throttle.
+	RateLimiter *RateLimiter
+
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewManager returns new Manager. The parameters are passed to NewWithStore to create each user's client.
+func NewManager(cid, secret, redirectURL string, store TokenStore, options ...ClientOption) *Manager {
+	return &Manager{
+		cid:         cid,
+		secret:      secret,
+		redirectURL: redirectURL,
+		store:       store,
+		options:     options,
+		RateLimiter: NewRateLimiter(DefaultAppLimit, Limit{}),
+		clients:     map[string]*Client{},
+	}
+}
+
+// ForUser returns the client of userid.
+// The client is created from the token in the token store on first use.
+// It returns ErrTokenNotFound if the token store does not have the token of userid.
+func (m *Manager) ForUser(userid string) (*Client, error) {
+	m.mu.Lock()
+	c, ok := m.clients[userid]
+	m.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	// Loading the token may be slow (e.g. decrypting it), so it does not block the other users.
+	c, err := NewWithStore(m.cid, m.secret, m.redirectURL, m.store, userid, m.options...)
+	if err != nil {
+		return nil, err
+	}
+	if !c.HasToken() {
+		return nil, fmt.Errorf("userid %s: %w", userid, ErrTokenNotFound)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Another goroutine may have created the client meanwhile.
+	if existing, ok := m.clients[userid]; ok {
+		return existing, nil
+	}
+	if c.RateLimiter == nil {
+		c.RateLimiter = m.RateLimiter
+	}
+	m.clients[userid] = c
+	return c, nil
+}
+
+// Add registers a newly authorized token and returns the client for it.
+// The token is saved to the token store under its userid.
+func (m *Manager) Add(token *oauth2.Token) (*Client, error) {
+	userid := TokenUserID(token)
+	if userid == "" {
+		return nil, errors.New("token does not have userid")
+	}
+
+	c, err := New(m.cid, m.secret, m.redirectURL, m.options...)
+	if err != nil {
+		return nil, err
+	}
+	c.Store = m.store
+	if c.RateLimiter == nil {
+		c.RateLimiter = m.RateLimiter
+	}
+	if err := c.SetToken(token); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[userid] = c
+	return c, nil
+}
+
+// Remove forgets the client of userid and deletes its token from the token store.
+func (m *Manager) Remove(userid string) error {
+	m.mu.Lock()
+	delete(m.clients, userid)
+	m.mu.Unlock()
+	return m.store.Delete(userid)
+}
+
+// Users returns sorted userids known to the manager.
+// They are the users whose clients were created and, if the token store implements TokenLister,
+// the users in the token store.
+func (m *Manager) Users() ([]string, error) {
+	known := map[string]bool{}
+	if l, ok := m.store.(TokenLister); ok {
+		users, err := l.Users()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			known[u] = true
+		}
+	}
+
+	m.mu.Lock()
+	for u := range m.clients {
+		known[u] = true
+	}
+	m.mu.Unlock()
+
+	users := make([]string, 0, len(known))
+	for u := range known {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// Each calls f with the client of every user in Users.
+// At most concurrency calls run at the same time. If concurrency is 0 or less, all calls run at once.
+// Users are not started after ctx is done. Each returns the errors of all users joined by errors.Join.
+func (m *Manager) Each(ctx context.Context, concurrency int, f func(ctx context.Context, userid string, c *Client) error) error {
+	users, err := m.Users()
+	if err != nil {
+		return err
+	}
+	if concurrency <= 0 {
+		concurrency = len(users)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	addErr := func(userid string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, fmt.Errorf("userid %s: %w", userid, err))
+	}
+
+	sem := make(chan struct{}, concurrency)
+	for _, u := range users {
+		select {
+		case <-ctx.Done():
+			addErr(u, ctx.Err())
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(userid string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			c, err := m.ForUser(userid)
+			if err == nil {
+				err = f(ctx, userid, c)
+			}
+			if err != nil {
+				addErr(userid, err)
+			}
+		}(u)
+	}
+	wg.Wait()
+
+	// errors.Join returns nil if errs is empty.
+	return errors.Join(errs...)
+}
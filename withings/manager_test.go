@@ -0,0 +1,130 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestManager(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	store := NewMemoryTokenStore()
+	store.Save("1", newTestToken("1"))
+	m := NewManager("cid", "secret", "http://localhost/callback", store)
+
+	if _, err := m.Add(newTestToken("2")); err != nil {
+		t.Fatalf("Add returns error(%v)", err)
+	}
+	if _, err := store.Load("2"); err != nil {
+		t.Errorf("Add did not save the token: %v", err)
+	}
+	if _, err := m.ForUser("3"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("ForUser returns error(%v), want %v", err, ErrTokenNotFound)
+	}
+
+	users, err := m.Users()
+	if err != nil {
+		t.Fatalf("Users returns error(%v)", err)
+	}
+	if len(users) != 2 || users[0] != "1" || users[1] != "2" {
+		t.Errorf("Users = %v, want [1 2]", users)
+	}
+
+	var running, maxRunning int32
+	err = m.Each(context.Background(), 1, func(ctx context.Context, userid string, c *Client) error {
+		if n := atomic.AddInt32(&running, 1); n > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, n)
+		}
+		defer atomic.AddInt32(&running, -1)
+
+		c.MeasureURL = fs.URL + "/measure"
+		_, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight)
+		return err
+	})
+	if err != nil {
+		t.Errorf("Each returns error(%v)", err)
+	}
+	if maxRunning != 1 {
+		t.Errorf("Each ran %d calls at once, want 1", maxRunning)
+	}
+	// Both users' requests are counted by the shared rate limiter.
+	if got, want := m.RateLimiter.AppBudget(), float64(DefaultAppLimit.Requests-2); got >= want+1 {
+		t.Errorf("AppBudget = %v, want about %v", got, want)
+	}
+
+	failed := errors.New("failed")
+	err = m.Each(context.Background(), 0, func(ctx context.Context, userid string, c *Client) error {
+		if userid == "2" {
+			return failed
+		}
+		return nil
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("Each returns error(%v), want %v", err, failed)
+	}
+}
+
+// blockingStore is TokenStore whose Load waits until release is closed.
+type blockingStore struct {
+	TokenStore
+	loading chan string
+	release chan struct{}
+}
+
+func (s *blockingStore) Load(userid string) (*oauth2.Token, error) {
+	s.loading <- userid
+	<-s.release
+	return s.TokenStore.Load(userid)
+}
+
+func TestManagerForUserConcurrent(t *testing.T) {
+	mem := NewMemoryTokenStore()
+	mem.Save("1", newTestToken("1"))
+	mem.Save("2", newTestToken("2"))
+	store := &blockingStore{TokenStore: mem, loading: make(chan string, 4), release: make(chan struct{})}
+	m := NewManager("cid", "secret", "http://localhost/callback", store)
+
+	type result struct {
+		c   *Client
+		err error
+	}
+	results := make(chan result, 3)
+	for _, userid := range []string{"1", "2", "1"} {
+		go func(userid string) {
+			c, err := m.ForUser(userid)
+			results <- result{c, err}
+		}(userid)
+	}
+
+	// All the loads run at once instead of one by one.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-store.loading:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d loads started, want 3 at once", i)
+		}
+	}
+	close(store.release)
+
+	clients := map[string]*Client{}
+	for i := 0; i < 3; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("ForUser returns error(%v)", r.err)
+		}
+		userid := TokenUserID(r.c.CurrentToken())
+		if prev, ok := clients[userid]; ok && prev != r.c {
+			t.Errorf("ForUser(%s) returns different clients", userid)
+		}
+		clients[userid] = r.c
+	}
+	if c, _ := m.ForUser("1"); c != clients["1"] {
+		t.Error("ForUser(1) does not return the registered client")
+	}
+}
@@ -2,8 +2,8 @@ package withings
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
@@ -27,12 +27,7 @@ type FormParam struct {
 var OffsetBase time.Time = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
 
 func createRequest(ctx context.Context, fp []FormParam, uri, method string) (*http.Request, error) {
-	form := url.Values{}
-	for _, v := range fp {
-		form.Add(v.key, v.value)
-	}
-
-	body := strings.NewReader(form.Encode())
+	body := strings.NewReader(formValues(fp).Encode())
 	u, err := url.ParseRequestURI(uri)
 	if err != nil {
 		return nil, err
@@ -47,18 +42,89 @@ func createRequest(ctx context.Context, fp []FormParam, uri, method string) (*ht
 	return req, nil
 }
 
-func parseResponse(resp *http.Response, result interface{}) error {
-	rbody, err := ioutil.ReadAll(resp.Body)
+// maxErrorBody is the maximum length of the body kept in APIError.
+const maxErrorBody = 512
+
+// parseResponse checks the status of the response and parses it to result.
+// It returns *APIError if withings rejected the request.
+func parseResponse(resp *http.Response, result streamDecoder) error {
+	if resp.StatusCode != http.StatusOK {
+		rbody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		if err != nil {
+			return err
+		}
+		return &APIError{HTTPStatus: resp.StatusCode, Message: string(rbody)}
+	}
+	return result.decodeStream(resp.Body)
+}
+
+// formValues returns fp as url.Values.
+func formValues(fp []FormParam) url.Values {
+	form := url.Values{}
+	for _, v := range fp {
+		form.Add(v.key, v.value)
+	}
+	return form
+}
+
+// formValue returns the value of key in fp.
+func formValue(fp []FormParam, key string) string {
+	for _, v := range fp {
+		if v.key == key {
+			return v.value
+		}
+	}
+	return ""
+}
+
+// reqAndParse sends the request and parses the response to result.
+// Failed requests are retried according to the retry policy of the client.
+func reqAndParse(ctx context.Context, c *Client, fp []FormParam, url, method string, result streamDecoder) error {
+	call := &Call{Action: formValue(fp, PPaction), Params: formValues(fp)}
+	ctx, done := c.startCall(ctx, call)
+	defer done()
+
+	log := c.logger()
+	start := time.Now()
+	err := retry(ctx, c.retryPolicy(ctx), func() error {
+		call.Attempts++
+		err := reqAndParseOnce(ctx, c, call, fp, url, method, result)
+		if err != nil {
+			log.DebugContext(ctx, "withings api call failed", "action", call.Action, "attempt", call.Attempts, "error", err)
+		}
+		call.Status = callStatus(err)
+		return err
+	})
+	call.Err = err
 	if err != nil {
+		log.WarnContext(ctx, "withings api call gave up", "action", call.Action, "attempts", call.Attempts, "status", call.Status, "error", err)
 		return err
 	}
-	return json.Unmarshal(rbody, result)
+
+	attrs := []any{"action", call.Action, "attempts", call.Attempts, "duration", time.Since(start)}
+	if p, ok := result.(pager); ok {
+		more, offset := p.page()
+		attrs = append(attrs, "more", more, "offset", offset)
+	}
+	log.DebugContext(ctx, "withings api call", attrs...)
+	return nil
 }
 
-func reqAndParse(c *Client, fp []FormParam, url, method string, result interface{}) error {
-	ctx, cancel := getNewContext(c.Timeout)
-	defer cancel()
+// reqAndParseOnce sends the request once with Client.Timeout.
+// Waiting for the rate limiter does not count toward the timeout.
+func reqAndParseOnce(ctx context.Context, c *Client, call *Call, fp []FormParam, url, method string, result streamDecoder) error {
+	ctx, waited, err := c.waitRateLimit(ctx)
+	call.RateLimitWait += waited
+	if err != nil {
+		return err
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
+	ctx = ContextWithAction(ctx, formValue(fp, PPaction))
 	req, err := createRequest(ctx, fp, url, method)
 	if err != nil {
 		return err
@@ -72,6 +138,11 @@ func reqAndParse(c *Client, fp []FormParam, url, method string, result interface
 
 	err = parseResponse(resp, result)
 	if err != nil {
+		// The error of Get*Func may be wrapped in partialError.
+		var aerr *APIError
+		if errors.As(err, &aerr) {
+			aerr.Action = formValue(fp, PPaction)
+		}
 		return err
 	}
 	return nil
@@ -110,12 +181,68 @@ func createDataFields(fields interface{}) (string, error) {
 // isSerialized: if true, results must be parsed to Measurement.SerializedData
 // mtype: Measurement Type. Set the measurement type you want to get data. See MeasType in enum.go.
 func (c *Client) GetMeas(cattype CatType, startdate, enddate, lastupdate time.Time, offset int, isOldToNew, isSerialized bool, mtype ...MeasType) (*Measurement, error) {
+	return c.GetMeasContext(context.Background(), cattype, startdate, enddate, lastupdate, offset, isOldToNew, isSerialized, mtype...)
+}
 
-	if len(mtype) == 0 {
-		return nil, errors.Errorf("Need least one param as MeasType.")
+// GetMeasContext is GetMeas with ctx. The request is canceled when ctx is done.
+// Client.Timeout limits each attempt within the deadline of ctx.
+func (c *Client) GetMeasContext(ctx context.Context, cattype CatType, startdate, enddate, lastupdate time.Time, offset int, isOldToNew, isSerialized bool, mtype ...MeasType) (*Measurement, error) {
+	fp, err := c.measParams(cattype, startdate, enddate, lastupdate, offset, mtype)
+	if err != nil {
+		return nil, err
+	}
+
+	mym := new(Measurement)
+	err = reqAndParse(ctx, c, fp, c.MeasureURL, http.MethodPost, mym)
+	if err != nil {
+		return nil, err
+	}
+
+	if isOldToNew {
+		sort.Slice(mym.Body.Measuregrps, func(i, j int) bool {
+			return time.Unix(int64(mym.Body.Measuregrps[i].Date), 0).Before(time.Unix(int64(mym.Body.Measuregrps[j].Date), 0))
+		})
+	} else {
+		sort.Slice(mym.Body.Measuregrps, func(i, j int) bool {
+			return time.Unix(int64(mym.Body.Measuregrps[i].Date), 0).After(time.Unix(int64(mym.Body.Measuregrps[j].Date), 0))
+		})
+	}
+
+	if isSerialized {
+		mym.SerializedData, err = SerialMeas(mym)
+		if err != nil {
+			mym.SerializedData = nil
+			return mym, err
+		}
+	}
+	return mym, nil
+}
+
+// GetMeasFunc is GetMeasContext which passes each measure group to f as soon as it is decoded,
+// instead of keeping all of them in memory. Measure groups are passed in the order of the response,
+// and the returned Measurement has no Measuregrps. If f returns an error, GetMeasFunc stops and returns it.
+// The call is not retried once a measure group has been passed to f.
+func (c *Client) GetMeasFunc(ctx context.Context, f func(MeasureGroup) error, cattype CatType, startdate, enddate, lastupdate time.Time, offset int, mtype ...MeasType) (*Measurement, error) {
+	fp, err := c.measParams(cattype, startdate, enddate, lastupdate, offset, mtype)
+	if err != nil {
+		return nil, err
 	}
 
 	mym := new(Measurement)
+	err = reqAndParse(ctx, c, fp, c.MeasureURL, http.MethodPost, &seriesFunc[MeasureGroup]{&mym.Status, &mym.Body, "measuregrps", f, mym})
+	if err != nil {
+		return nil, err
+	}
+	return mym, nil
+}
+
+func (c *Client) measParams(cattype CatType, startdate, enddate, lastupdate time.Time, offset int, mtype []MeasType) ([]FormParam, error) {
+	if len(mtype) == 0 {
+		return nil, errors.Errorf("Need least one param as MeasType.")
+	}
+	if err := c.checkScope("GetMeas"); err != nil {
+		return nil, err
+	}
 
 	df, err := createDataFields(mtype)
 	if err != nil {
@@ -142,30 +269,7 @@ func (c *Client) GetMeas(cattype CatType, startdate, enddate, lastupdate time.Ti
 		fp = append(fp, FormParam{PPstartdate, strconv.FormatInt(startdate.Unix(), 10)})
 		fp = append(fp, FormParam{PPenddate, strconv.FormatInt(enddate.Unix(), 10)})
 	}
-
-	err = reqAndParse(c, fp, c.MeasureURL, http.MethodPost, mym)
-	if err != nil {
-		return nil, err
-	}
-
-	if isOldToNew {
-		sort.Slice(mym.Body.Measuregrps, func(i, j int) bool {
-			return time.Unix(int64(mym.Body.Measuregrps[i].Date), 0).Before(time.Unix(int64(mym.Body.Measuregrps[j].Date), 0))
-		})
-	} else {
-		sort.Slice(mym.Body.Measuregrps, func(i, j int) bool {
-			return time.Unix(int64(mym.Body.Measuregrps[i].Date), 0).After(time.Unix(int64(mym.Body.Measuregrps[j].Date), 0))
-		})
-	}
-
-	if isSerialized {
-		mym.SerializedData, err = SerialMeas(mym)
-		if err != nil {
-			mym.SerializedData = nil
-			return mym, err
-		}
-	}
-	return mym, nil
+	return fp, nil
 }
 
 // SerialMeas will parse measurement results.
@@ -233,12 +337,53 @@ func SerialMeas(mym *Measurement) (*SerialzedMeas, error) {
 // offset: When a first call retuns more:1 and offset:XX, set value XX in this parameter to retrieve next available rows.
 // atype: Acitivity Type. Set the activity type you want to get data. See ActivityType in enum.go.
 func (c *Client) GetActivity(startdate, enddate string, lastupdate int, offset int, atype ...ActivityType) (*Activities, error) {
+	return c.GetActivityContext(context.Background(), startdate, enddate, lastupdate, offset, atype...)
+}
+
+// GetActivityContext is GetActivity with ctx. The request is canceled when ctx is done.
+// Client.Timeout limits each attempt within the deadline of ctx.
+func (c *Client) GetActivityContext(ctx context.Context, startdate, enddate string, lastupdate int, offset int, atype ...ActivityType) (*Activities, error) {
+	fp, err := c.activityParams(startdate, enddate, lastupdate, offset, atype)
+	if err != nil {
+		return nil, err
+	}
+
+	act := new(Activities)
+	err = reqAndParse(ctx, c, fp, c.MeasureURLv2, http.MethodPost, act)
+	if err != nil {
+		return nil, err
+	}
+	return act, nil
+}
+
+// GetActivityFunc is GetActivityContext which passes each activity to f as soon as it is decoded.
+// The returned Activities has no Activities. See GetMeasFunc.
+func (c *Client) GetActivityFunc(ctx context.Context, f func(Activity) error, startdate, enddate string, lastupdate int, offset int, atype ...ActivityType) (*Activities, error) {
+	fp, err := c.activityParams(startdate, enddate, lastupdate, offset, atype)
+	if err != nil {
+		return nil, err
+	}
+
+	act := new(Activities)
+	err = reqAndParse(ctx, c, fp, c.MeasureURLv2, http.MethodPost, &seriesFunc[Activity]{&act.Status, &act.Body, "activities", f, act})
+	if err != nil {
+		return nil, err
+	}
+	return act, nil
+}
+
+func (c *Client) activityParams(startdate, enddate string, lastupdate int, offset int, atype []ActivityType) ([]FormParam, error) {
 	if len(atype) == 0 {
 		return nil, errors.Errorf("Need least one param as ActivityType.")
 	}
-	act := new(Activities)
+	if err := c.checkScope("GetActivity"); err != nil {
+		return nil, err
+	}
 
 	df, err := createDataFields(atype)
+	if err != nil {
+		return nil, err
+	}
 
 	var fp []FormParam = []FormParam{
 		{PPaction, ActivityA},
@@ -251,12 +396,7 @@ func (c *Client) GetActivity(startdate, enddate string, lastupdate int, offset i
 	} else {
 		fp = append(fp, FormParam{PPstartdateymd, startdate}, FormParam{PPenddateymd, enddate})
 	}
-
-	err = reqAndParse(c, fp, c.MeasureURLv2, http.MethodPost, act)
-	if err != nil {
-		return nil, err
-	}
-	return act, nil
+	return fp, nil
 }
 
 // GetWorkouts call withings API Measure v2 - Getworkouts. (https://developer.withings.com/api-reference#operation/measurev2-getworkouts)
@@ -266,12 +406,53 @@ func (c *Client) GetActivity(startdate, enddate string, lastupdate int, offset i
 // offset: When a first call retuns more:1 and offset:XX, set value XX in this parameter to retrieve next available rows.
 // wtype: Workout Type. Set the workout type you want to get data. See WorkoutType in enum.go.
 func (c *Client) GetWorkouts(startdate, enddate string, lastupdate int, offset int, wtype ...WorkoutType) (*Workouts, error) {
+	return c.GetWorkoutsContext(context.Background(), startdate, enddate, lastupdate, offset, wtype...)
+}
+
+// GetWorkoutsContext is GetWorkouts with ctx. The request is canceled when ctx is done.
+// Client.Timeout limits each attempt within the deadline of ctx.
+func (c *Client) GetWorkoutsContext(ctx context.Context, startdate, enddate string, lastupdate int, offset int, wtype ...WorkoutType) (*Workouts, error) {
+	fp, err := c.workoutsParams(startdate, enddate, lastupdate, offset, wtype)
+	if err != nil {
+		return nil, err
+	}
+
+	workouts := new(Workouts)
+	err = reqAndParse(ctx, c, fp, c.MeasureURLv2, http.MethodPost, workouts)
+	if err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+// GetWorkoutsFunc is GetWorkoutsContext which passes each workout to f as soon as it is decoded.
+// The returned Workouts has no Series. See GetMeasFunc.
+func (c *Client) GetWorkoutsFunc(ctx context.Context, f func(Workout) error, startdate, enddate string, lastupdate int, offset int, wtype ...WorkoutType) (*Workouts, error) {
+	fp, err := c.workoutsParams(startdate, enddate, lastupdate, offset, wtype)
+	if err != nil {
+		return nil, err
+	}
+
+	workouts := new(Workouts)
+	err = reqAndParse(ctx, c, fp, c.MeasureURLv2, http.MethodPost, &seriesFunc[Workout]{&workouts.Status, &workouts.Body, "series", f, workouts})
+	if err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+func (c *Client) workoutsParams(startdate, enddate string, lastupdate int, offset int, wtype []WorkoutType) ([]FormParam, error) {
 	if len(wtype) == 0 {
 		return nil, errors.Errorf("Need least one param as WorkoutType.")
 	}
-	workouts := new(Workouts)
+	if err := c.checkScope("GetWorkouts"); err != nil {
+		return nil, err
+	}
 
 	df, err := createDataFields(wtype)
+	if err != nil {
+		return nil, err
+	}
 
 	var fp []FormParam = []FormParam{
 		{PPaction, WorkoutsA},
@@ -284,21 +465,60 @@ func (c *Client) GetWorkouts(startdate, enddate string, lastupdate int, offset i
 	} else {
 		fp = append(fp, FormParam{PPstartdateymd, startdate}, FormParam{PPenddateymd, enddate})
 	}
-
-	err = reqAndParse(c, fp, c.MeasureURLv2, http.MethodPost, workouts)
-	if err != nil {
-		return nil, err
-	}
-	return workouts, nil
+	return fp, nil
 }
 
 // GetSleep cal withings API Sleep v2 - Get. (https://developer.withings.com/oauth2/#operation/sleepv2-get)
 // startdate/enddate: Measures' start date, end date.
 // stype: Sleep Type. Set the sleep type you want to get data. See SleepType in enum.go.
 func (c *Client) GetSleep(startdate, enddate time.Time, stype ...SleepType) (*Sleeps, error) {
+	return c.GetSleepContext(context.Background(), startdate, enddate, stype...)
+}
+
+// GetSleepContext is GetSleep with ctx. The request is canceled when ctx is done.
+// Client.Timeout limits each attempt within the deadline of ctx.
+func (c *Client) GetSleepContext(ctx context.Context, startdate, enddate time.Time, stype ...SleepType) (*Sleeps, error) {
+	fp, err := c.sleepParams(startdate, enddate, stype)
+	if err != nil {
+		return nil, err
+	}
+
+	slp := new(Sleeps)
+	err = reqAndParse(ctx, c, fp, c.SleepURLv2, http.MethodPost, slp)
+	if err != nil {
+		return nil, err
+	}
+
+	// sort by startdate
+	sort.Slice(slp.Body.Series, func(i, j int) bool {
+		return slp.Body.Series[i].Startdate < slp.Body.Series[j].Startdate
+	})
+	return slp, nil
+}
+
+// GetSleepFunc is GetSleepContext which passes each sleep series to f as soon as it is decoded.
+// The series are passed in the order of the response, and the returned Sleeps has no Series. See GetMeasFunc.
+func (c *Client) GetSleepFunc(ctx context.Context, f func(SleepSeries) error, startdate, enddate time.Time, stype ...SleepType) (*Sleeps, error) {
+	fp, err := c.sleepParams(startdate, enddate, stype)
+	if err != nil {
+		return nil, err
+	}
+
+	slp := new(Sleeps)
+	err = reqAndParse(ctx, c, fp, c.SleepURLv2, http.MethodPost, &seriesFunc[SleepSeries]{&slp.Status, &slp.Body, "series", f, slp})
+	if err != nil {
+		return nil, err
+	}
+	return slp, nil
+}
+
+func (c *Client) sleepParams(startdate, enddate time.Time, stype []SleepType) ([]FormParam, error) {
 	if len(stype) == 0 {
 		return nil, errors.Errorf("Need least one param as SleepType.")
 	}
+	if err := c.checkScope("GetSleep"); err != nil {
+		return nil, err
+	}
 
 	df, err := createDataFields(stype)
 	if err != nil {
@@ -311,29 +531,64 @@ func (c *Client) GetSleep(startdate, enddate time.Time, stype ...SleepType) (*Sl
 		{PPenddate, strconv.FormatInt(enddate.Unix(), 10)},
 		{PPdataFields, df},
 	}
+	return fp, nil
+}
 
-	slp := new(Sleeps)
-	err = reqAndParse(c, fp, c.SleepURLv2, http.MethodPost, slp)
+// GetSleepSummary call withings API Sleep v2 - Getsummary. (https://developer.withings.com/oauth2/#operation/sleepv2-getsummary)
+// startdate/enddate: Measurement result start date, end date.
+// lastupdate : Timestamp for requesting data that were updated or created after this date. Use this instead of startdate+endate.
+//              If lastupdate is set to a timestamp other than Offsetbase, getMeas will use lastupdate in preference to startdate/enddate.
+// stype: Sleep Summaries Type. Set the sleep summaries data you want to get. See SleepSummariesType in enum.go.
+func (c *Client) GetSleepSummary(startdate, enddate string, lastupdate int, sstype ...SleepSummariesType) (*SleepSummaries, error) {
+	return c.GetSleepSummaryContext(context.Background(), startdate, enddate, lastupdate, sstype...)
+}
+
+// GetSleepSummaryContext is GetSleepSummary with ctx. The request is canceled when ctx is done.
+// Client.Timeout limits each attempt within the deadline of ctx.
+func (c *Client) GetSleepSummaryContext(ctx context.Context, startdate, enddate string, lastupdate int, sstype ...SleepSummariesType) (*SleepSummaries, error) {
+	fp, err := c.sleepSummaryParams(startdate, enddate, lastupdate, sstype)
+	if err != nil {
+		return nil, err
+	}
+
+	slpss := new(SleepSummaries)
+	err = reqAndParse(ctx, c, fp, c.SleepURLv2, http.MethodPost, slpss)
 	if err != nil {
 		return nil, err
 	}
 
 	// sort by startdate
-	sort.Slice(slp.Body.Series, func(i, j int) bool {
-		return slp.Body.Series[i].Startdate < slp.Body.Series[j].Startdate
+	sort.Slice(slpss.Body.Series, func(i, j int) bool {
+		return slpss.Body.Series[i].Startdate < slpss.Body.Series[j].Startdate
 	})
-	return slp, nil
+
+	return slpss, nil
 }
 
-// GetSleepSummary call withings API Sleep v2 - Getsummary. (https://developer.withings.com/oauth2/#operation/sleepv2-getsummary)
-// startdate/enddate: Measurement result start date, end date.
-// lastupdate : Timestamp for requesting data that were updated or created after this date. Use this instead of startdate+endate.
-//              If lastupdate is set to a timestamp other than Offsetbase, getMeas will use lastupdate in preference to startdate/enddate.
-// stype: Sleep Summaries Type. Set the sleep summaries data you want to get. See SleepSummariesType in enum.go.
-func (c *Client) GetSleepSummary(startdate, enddate string, lastupdate int, sstype ...SleepSummariesType) (*SleepSummaries, error) {
+// GetSleepSummaryFunc is GetSleepSummaryContext which passes each sleep summary to f as soon as it is decoded.
+// The summaries are passed in the order of the response, and the returned SleepSummaries has no Series. See GetMeasFunc.
+func (c *Client) GetSleepSummaryFunc(ctx context.Context, f func(SleepSummary) error, startdate, enddate string, lastupdate int, sstype ...SleepSummariesType) (*SleepSummaries, error) {
+	fp, err := c.sleepSummaryParams(startdate, enddate, lastupdate, sstype)
+	if err != nil {
+		return nil, err
+	}
+
+	slpss := new(SleepSummaries)
+	err = reqAndParse(ctx, c, fp, c.SleepURLv2, http.MethodPost, &seriesFunc[SleepSummary]{&slpss.Status, &slpss.Body, "series", f, slpss})
+	if err != nil {
+		return nil, err
+	}
+	return slpss, nil
+}
+
+func (c *Client) sleepSummaryParams(startdate, enddate string, lastupdate int, sstype []SleepSummariesType) ([]FormParam, error) {
 	if len(sstype) == 0 {
 		return nil, errors.Errorf("Need least one param as SleepSummariesType.")
 	}
+	if err := c.checkScope("GetSleepSummary"); err != nil {
+		return nil, err
+	}
+
 	df, err := createDataFields(sstype)
 	if err != nil {
 		return nil, err
@@ -349,16 +604,5 @@ func (c *Client) GetSleepSummary(startdate, enddate string, lastupdate int, ssty
 	} else {
 		fp = append(fp, FormParam{PPstartdateymd, startdate}, FormParam{PPenddateymd, enddate})
 	}
-	slpss := new(SleepSummaries)
-	err = reqAndParse(c, fp, c.SleepURLv2, http.MethodPost, slpss)
-	if err != nil {
-		return nil, err
-	}
-
-	// sort by startdate
-	sort.Slice(slpss.Body.Series, func(i, j int) bool {
-		return slpss.Body.Series[i].Startdate < slpss.Body.Series[j].Startdate
-	})
-
-	return slpss, nil
+	return fp, nil
 }
@@ -1,6 +1,8 @@
 package withings
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,6 +13,10 @@ import (
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+
+	"golang.org/x/oauth2"
+
+	"github.com/zono-dev/withings-go/withings/cassette"
 )
 
 const (
@@ -34,12 +40,16 @@ var (
 	lastupdate time.Time
 	ed         string
 	sd         string
-	settings   map[string]string
+	settings   *Settings
 	client     *(Client)
 )
 
 func setupForTest(settingsFile string, t *testing.T) {
-	settings = ReadSettings(settingsFile)
+	var err error
+	settings, err = LoadSettings(settingsFile)
+	if err != nil {
+		t.Fatalf("LoadSettings returns error(%v)", err)
+	}
 	authWithTokenFile(settings, t)
 	tokenFuncs()
 	// to get data from a day ago to now
@@ -54,9 +64,9 @@ func setupForTest(settingsFile string, t *testing.T) {
 	//lastupdate = time.Date(2020, 12, 20, 0, 0, 0, 0, time.UTC)
 }
 
-func authWithTokenFile(settings map[string]string, t *testing.T) {
+func authWithTokenFile(settings *Settings, t *testing.T) {
 	var err error
-	client, err = New(settings["cid"], settings["secret"], settings["redirect_url"])
+	client, err = NewFromSettings(settings)
 
 	if err != nil {
 		t.Errorf("Failed to create New client:%v", err)
@@ -103,31 +113,55 @@ func tokenFuncs() {
 	//client.PrintToken()
 }
 
-//func TestGetMeas(t *testing.T) {
-//	setupForTest(testSettingsFile, t)
-//	jsonBlob, err := ioutil.ReadFile(testMeasureFile)
-//	if err != nil {
-//		t.Fatalf("ioutil.ReadFile returns error(%v)", err)
-//	}
-//
-//	ts := httptest.NewServer(http.HandlerFunc(
-//		func(w http.ResponseWriter, r *http.Request) {
-//			w.Header().Set("Content-Type", "application/json")
-//			//d := TestStruct{"Bob", 18}
-//			//slcBob, _ := json.Marshal(d)
-//			//w.Write(slcBob)
-//			w.Write(jsonBlob)
-//		}))
-//	defer ts.Close()
-//
-//	client.MeasureURL = ts.URL
-//	res, err := client.GetMeas(Real, adayago, tnow, lastupdate, 0, Weight, Height, FatFreeMass)
-//	if err != nil {
-//		t.Errorf("client.GetMeas returned error:%v", err)
-//	} else {
-//		fmt.Println(res)
-//	}
-//}
+// testGetMeasCassette is the recorded session of GetMeas with an expired token.
+// Record it again with WITHINGS_CASSETTE=record and the settings and the token file of your app.
+const testGetMeasCassette = "testdata/getmeas.json"
+
+func TestGetMeas(t *testing.T) {
+	rec, err := cassette.New(testGetMeasCassette, cassette.ModeFromEnv())
+	if err != nil {
+		t.Fatalf("cassette.New returns error(%v)", err)
+	}
+
+	var c *Client
+	if rec.Mode() == cassette.ModeRecord {
+		setupForTest(testSettingsFile, t)
+		c = client
+		if err := WithTransport(rec)(c); err != nil {
+			t.Fatalf("WithTransport returns error(%v)", err)
+		}
+	} else {
+		c, err = New("cid", "secret", "http://localhost/callback", WithTransport(rec))
+		if err != nil {
+			t.Fatalf("New returns error(%v)", err)
+		}
+		expired := &oauth2.Token{AccessToken: "expired", RefreshToken: "refresh", TokenType: "Bearer", Expiry: time.Now().Add(-time.Hour)}
+		c.SetToken(expired.WithExtra(map[string]interface{}{"userid": "363"}))
+	}
+
+	start := time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC)
+	res, err := c.GetMeas(Real, start, end, OffsetBase, 0, false, true, Weight, Height, FatFreeMass)
+	if err != nil {
+		t.Fatalf("client.GetMeas returned error:%v", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+	if rec.Mode() == cassette.ModeRecord {
+		return
+	}
+
+	if len(res.Body.Measuregrps) == 0 || len(res.SerializedData.Weights) == 0 {
+		t.Fatalf("GetMeas returns no measures: %+v", res.Body)
+	}
+	if w := res.SerializedData.Weights[0]; w.Value != 81.2 {
+		t.Errorf("Weights[0].Value = %v, want 81.2", w.Value)
+	}
+	if c.CurrentToken().AccessToken != "REDACTED" {
+		t.Errorf("token is not refreshed with the recorded response: %s", c.CurrentToken().AccessToken)
+	}
+}
 
 func callCreateDataFields(correct string, mtype interface{}, t *testing.T) {
 	df, err := createDataFields(mtype)
@@ -205,7 +239,7 @@ func TestCreateRequest(t *testing.T) {
 		{PPcategory, fmt.Sprintf("%d", Real)},
 	}
 
-	ctx, cancel := getNewContext(5)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	res, err := createRequest(ctx, fp, URL, http.MethodPost)
@@ -227,7 +261,6 @@ type TestStruct struct {
 	Age  int    `json:"int"`
 }
 
-// TODO: add fail pattern
 func TestParseResponse(t *testing.T) {
 
 	jsonBlob, err := ioutil.ReadFile(testMeasureFile)
@@ -266,3 +299,47 @@ func TestParseResponse(t *testing.T) {
 		fmt.Println(err)
 	}
 }
+
+func TestParseResponseAPIError(t *testing.T) {
+	cases := []struct {
+		code int
+		body string
+		want error
+	}{
+		{http.StatusOK, `{"status":401,"body":{},"error":"XRequestID: Not provided invalid_token: The access token provided is invalid"}`, ErrAuthFailure},
+		{http.StatusOK, `{"status":503,"body":{},"error":"Invalid params"}`, ErrInvalidParams},
+		{http.StatusOK, `{"status":601,"body":{},"error":"Too Many Requests"}`, ErrRateLimited},
+		{http.StatusOK, `{"status":2555,"body":{},"error":"An unknown error occurred"}`, ErrServerError},
+		{http.StatusBadGateway, `Bad Gateway`, ErrServerError},
+	}
+
+	for _, c := range cases {
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.code)
+				w.Write([]byte(c.body))
+			}))
+
+		client, err := New("cid", "secret", "http://localhost/callback")
+		if err != nil {
+			t.Fatalf("New returns error(%v)", err)
+		}
+		client.SetToken(newTestToken("363"))
+		client.MeasureURL = ts.URL
+		// Retries are tested in retry_test.go.
+		client.RetryPolicy = NoRetry
+
+		_, err = client.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight)
+		ts.Close()
+
+		if !errors.Is(err, c.want) {
+			t.Errorf("GetMeas returns error(%v), want %v", err, c.want)
+		}
+		var aerr *APIError
+		if !errors.As(err, &aerr) {
+			t.Errorf("GetMeas returns error(%v), want *APIError", err)
+		} else if aerr.Action != MeasureA {
+			t.Errorf("APIError.Action = %s, want %s", aerr.Action, MeasureA)
+		}
+	}
+}
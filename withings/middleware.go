@@ -0,0 +1,97 @@
+package withings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// Middleware wraps the http.RoundTripper which sends the requests of the client.
+// Middlewares see every request to withings including token refreshes, with the Authorization header set.
+// The withings action of the request is given by ActionFromContext(req.Context()).
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to use a function as http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use adds middlewares to the client. The first middleware is the outermost one.
+// Call it while configuring the client, before it is used.
+func (c *Client) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middlewares = append(c.middlewares, mw...)
+	c.chain = nil
+}
+
+// WithMiddleware adds middlewares to the client. See Client.Use.
+func WithMiddleware(mw ...Middleware) ClientOption {
+	return func(c *Client) error {
+		c.Use(mw...)
+		return nil
+	}
+}
+
+// roundTripper returns the base transport of the client wrapped by the middlewares.
+// The chain is built once and reused, so each middleware wraps the transport only once.
+func (c *Client) roundTripper() http.RoundTripper {
+	c.mu.RLock()
+	rt := c.chain
+	c.mu.RUnlock()
+	if rt != nil {
+		return rt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chain != nil {
+		return c.chain
+	}
+	rt = c.transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+	c.chain = rt
+	return rt
+}
+
+type actionKey struct{}
+
+// ContextWithAction returns a context which has the withings action (e.g. getmeas).
+func ContextWithAction(ctx context.Context, action string) context.Context {
+	return context.WithValue(ctx, actionKey{}, action)
+}
+
+// ActionFromContext returns the withings action of the request, e.g. getmeas, or requesttoken for token requests.
+// It returns "" if the request is not an API call of the client.
+func ActionFromContext(ctx context.Context) string {
+	action, _ := ctx.Value(actionKey{}).(string)
+	return action
+}
+
+// ResponseStatus reads the withings status of resp, e.g. of a token request in a middleware,
+// and restores the body so that it can be read again. ok is false if the body has no status.
+func ResponseStatus(resp *http.Response) (status int, ok bool) {
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return 0, false
+	}
+	var v struct {
+		Status *int `json:"status"`
+	}
+	if json.Unmarshal(b, &v) != nil || v.Status == nil {
+		return 0, false
+	}
+	return *v.Status, true
+}
@@ -0,0 +1,104 @@
+package withings
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				mu.Lock()
+				calls = append(calls, name+":"+ActionFromContext(req.Context()))
+				mu.Unlock()
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	header := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Test", "1")
+			if ActionFromContext(req.Context()) == MeasureA && req.Header.Get("Authorization") == "" {
+				t.Error("middleware got the request without Authorization header")
+			}
+			return next.RoundTrip(req)
+		})
+	}
+
+	c := newFakeClient(t, fs)
+	c.Use(record("outer"), header)
+	if err := WithMiddleware(record("inner"))(c); err != nil {
+		t.Fatalf("WithMiddleware returns error(%v)", err)
+	}
+
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	want := []string{"outer:requesttoken", "inner:requesttoken", "outer:getmeas", "inner:getmeas"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls[%d] = %s, want %s", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestMiddlewareWrapsOnce(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	var wraps int
+	c := newFakeClient(t, fs)
+	c.Use(func(next http.RoundTripper) http.RoundTripper {
+		wraps++
+		return next
+	})
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+			t.Fatalf("GetMeas returns error(%v)", err)
+		}
+	}
+	if wraps != 1 {
+		t.Errorf("middleware wraps the transport %d times, want 1", wraps)
+	}
+}
+
+func TestResponseStatus(t *testing.T) {
+	cases := []struct {
+		body   string
+		status int
+		ok     bool
+	}{
+		{`{"status":0,"body":{"access_token":"a"}}`, 0, true},
+		{`{"status":503,"body":{},"error":"Invalid Params"}`, 503, true},
+		{`{"body":{}}`, 0, false},
+		{`Bad Gateway`, 0, false},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Body: io.NopCloser(strings.NewReader(c.body))}
+		status, ok := ResponseStatus(resp)
+		if status != c.status || ok != c.ok {
+			t.Errorf("ResponseStatus(%s) = %d, %v, want %d, %v", c.body, status, ok, c.status, c.ok)
+		}
+		// The body can be read again.
+		if b, _ := io.ReadAll(resp.Body); string(b) != c.body {
+			t.Errorf("body after ResponseStatus = %s, want %s", b, c.body)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Call describes an API call for CallObserver.
+// Action and Params are set when the call starts, and the others when it ends.
+type Call struct {
+	// Action is the withings action, e.g. getmeas.
+	Action string
+	// Params are the form parameters of the request, e.g. meastype, startdate and offset.
+	Params url.Values
+	// Attempts is the number of requests sent including retries.
+	Attempts int
+	// RateLimitWait is how long the call waited for the rate limiter in total.
+	RateLimitWait time.Duration
+	// Status is the withings status of the last response, or the HTTP status code if it was not 200.
+	// It is 0 if the call succeeded or no response was received.
+	Status int
+	// Err is the error of the call.
+	Err error
+}
+
+// CallObserver observes API calls, e.g. for tracing and metrics.
+// It is called when the call starts and returns the context for the call, which is the context of its requests,
+// and the function called when the call ends.
+type CallObserver func(ctx context.Context, call *Call) (context.Context, func())
+
+// Observe adds observers of the API calls. Call it while configuring the client, before it is used.
+func (c *Client) Observe(obs ...CallObserver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observers = append(c.observers, obs...)
+}
+
+// WithCallObserver adds observers of the API calls. See Client.Observe.
+func WithCallObserver(obs ...CallObserver) ClientOption {
+	return func(c *Client) error {
+		c.Observe(obs...)
+		return nil
+	}
+}
+
+// startCall calls the observers at the start of call.
+// The returned function must be called when call ended.
+func (c *Client) startCall(ctx context.Context, call *Call) (context.Context, func()) {
+	c.mu.RLock()
+	obs := c.observers
+	c.mu.RUnlock()
+	if len(obs) == 0 {
+		return ctx, func() {}
+	}
+
+	var (
+		dones = make([]func(), 0, len(obs))
+		once  sync.Once
+	)
+	for _, o := range obs {
+		var done func()
+		ctx, done = o(ctx, call)
+		if done != nil {
+			dones = append(dones, done)
+		}
+	}
+	return ctx, func() {
+		once.Do(func() {
+			// The innermost observer ends first.
+			for i := len(dones) - 1; i >= 0; i-- {
+				dones[i]()
+			}
+		})
+	}
+}
+
+// callStatus returns Call.Status for err.
+func callStatus(err error) int {
+	var aerr *APIError
+	if !errors.As(err, &aerr) {
+		return 0
+	}
+	if aerr.HTTPStatus != 0 {
+		return aerr.HTTPStatus
+	}
+	return aerr.Status
+}
@@ -0,0 +1,59 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type callKey struct{}
+
+func TestCallObserver(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+	ts, _ := newFlakyServer(t, 601, 1)
+	defer ts.Close()
+
+	var started, ended []Call
+	c := newFakeClient(t, fs)
+	c.MeasureURL = ts.URL
+	c.RetryPolicy = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	c.Observe(func(ctx context.Context, call *Call) (context.Context, func()) {
+		started = append(started, *call)
+		return context.WithValue(ctx, callKey{}, call.Action), func() { ended = append(ended, *call) }
+	})
+	c.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if got := req.Context().Value(callKey{}); got != MeasureA {
+				t.Errorf("request context has %v, want the context of the observer", got)
+			}
+			return next.RoundTrip(req)
+		})
+	})
+
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 10, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if len(started) != 1 || len(ended) != 1 {
+		t.Fatalf("observer started %d and ended %d calls, want 1", len(started), len(ended))
+	}
+	if s := started[0]; s.Action != MeasureA || s.Params.Get(PPoffset) != "10" || s.Attempts != 0 {
+		t.Errorf("started call = %+v", s)
+	}
+	if e := ended[0]; e.Attempts != 2 || e.Status != 0 || e.Err != nil {
+		t.Errorf("ended call = %+v, want 2 attempts without error", e)
+	}
+
+	c.RetryPolicy = NoRetry
+	ts2, _ := newFlakyServer(t, 503, 1)
+	defer ts2.Close()
+	c.MeasureURL = ts2.URL
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err == nil {
+		t.Fatal("GetMeas returns no error")
+	}
+	if e := ended[1]; e.Attempts != 1 || e.Status != 503 || !errors.Is(e.Err, ErrInvalidParams) {
+		t.Errorf("ended call = %+v, want status 503", e)
+	}
+}
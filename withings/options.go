@@ -0,0 +1,92 @@
+package withings
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClientOption customizes the client created by New.
+// Options configure the client itself, so they are kept when the token is replaced or refreshed.
+type ClientOption func(*Client) error
+
+// WithTransport sets the base http.RoundTripper of API requests and token refreshes.
+// The client adds the Authorization header on top of it. http.DefaultTransport is used by default.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) error {
+		if rt == nil {
+			return errors.New("transport is nil")
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.transport = rt
+		c.chain = nil
+		return nil
+	}
+}
+
+// WithTimeout sets Client.Timeout, the timeout of each attempt of API calls.
+// Zero means no timeout except for the deadline of the context.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return errors.Errorf("timeout must not be negative, got %v", timeout)
+		}
+		c.Timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent sets User-Agent header of API requests.
+func WithUserAgent(ua string) ClientOption {
+	return func(c *Client) error {
+		c.UserAgent = ua
+		return nil
+	}
+}
+
+// WithBaseURL replaces https://wbsapi.withings.net of the API and token URLs with baseURL,
+// e.g. for a proxy or a fake server in tests. See EndpointsFromBaseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) error {
+		e, err := EndpointsFromBaseURL(baseURL)
+		if err != nil {
+			return err
+		}
+		return c.SetEndpoints(e)
+	}
+}
+
+// WithLogger sets Client.Logger.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) error {
+		c.Logger = logger
+		return nil
+	}
+}
+
+// WithRetry sets Client.RetryPolicy. See also WithRetryPolicy to override it per call.
+func WithRetry(p RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.RetryPolicy = p
+		return nil
+	}
+}
+
+// WithRateLimiter sets Client.RateLimiter. Pass the same limiter to all clients of the app.
+func WithRateLimiter(l *RateLimiter) ClientOption {
+	return func(c *Client) error {
+		c.RateLimiter = l
+		return nil
+	}
+}
+
+// WithTokenStore sets Client.Store. The token is not loaded; use NewWithStore or LoadToken for it.
+func WithTokenStore(store TokenStore) ClientOption {
+	return func(c *Client) error {
+		c.Store = store
+		return nil
+	}
+}
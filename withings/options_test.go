@@ -0,0 +1,142 @@
+package withings
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// recordingTransport records the requests and sends them with http.DefaultTransport.
+type recordingTransport struct {
+	reqs []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.reqs = append(t.reqs, req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientOptions(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	rt := &recordingTransport{}
+	var logs bytes.Buffer
+	limiter := NewRateLimiter(Limit{}, Limit{})
+	store := NewMemoryTokenStore()
+	c, err := New("cid", "secret", "http://localhost/callback",
+		WithBaseURL(fs.URL+"/"),
+		WithTransport(rt),
+		WithTimeout(time.Second),
+		WithUserAgent("withings-go-test"),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithRetry(NoRetry),
+		WithRateLimiter(limiter),
+		WithTokenStore(store),
+	)
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+
+	if c.MeasureURL != fs.URL+"/measure" || c.MeasureURLv2 != fs.URL+"/v2/measure" ||
+		c.SleepURLv2 != fs.URL+"/v2/sleep" || c.Conf.Endpoint.TokenURL != fs.URL+"/v2/oauth2" {
+		t.Errorf("URLs = %s, %s, %s, %s", c.MeasureURL, c.MeasureURLv2, c.SleepURLv2, c.Conf.Endpoint.TokenURL)
+	}
+	if c.Timeout != time.Second || c.RetryPolicy.MaxAttempts != 1 || c.RateLimiter != limiter || c.Store != store {
+		t.Errorf("options are not applied: %+v", c)
+	}
+
+	// The options survive replacing and refreshing the token.
+	expired := &oauth2.Token{AccessToken: "expired", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)}
+	if err := c.SetToken(expired.WithExtra(map[string]interface{}{"userid": "363"})); err != nil {
+		t.Fatalf("SetToken returns error(%v)", err)
+	}
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	// The token refresh and two API calls.
+	if len(rt.reqs) != 3 {
+		t.Fatalf("transport got %d requests, want 3", len(rt.reqs))
+	}
+	if action := ActionFromContext(rt.reqs[0].Context()); action != RequestTokenA {
+		t.Errorf("the first request is %q, want %s", action, RequestTokenA)
+	}
+	for _, req := range rt.reqs[1:] {
+		if ua := req.Header.Get("User-Agent"); ua != "withings-go-test" {
+			t.Errorf("User-Agent = %q, want withings-go-test", ua)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer access-1" {
+			t.Errorf("Authorization = %q, want Bearer access-1", auth)
+		}
+	}
+	if !strings.Contains(logs.String(), "withings token refreshed") {
+		t.Errorf("logs = %q, want token refresh", logs.String())
+	}
+	if _, err := store.Load("363"); err != nil {
+		t.Errorf("refreshed token is not saved: %v", err)
+	}
+}
+
+func TestClientOptionsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		option ClientOption
+	}{
+		{"nil transport", WithTransport(nil)},
+		{"negative timeout", WithTimeout(-time.Second)},
+		{"relative base url", WithBaseURL("/api")},
+		{"ftp base url", WithBaseURL("ftp://example.com")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("cid", "secret", "http://localhost/callback", tt.option); err == nil {
+				t.Error("New returns no error")
+			}
+		})
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var requests int32
+	ts := newSeriesServer(3, &requests)
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	c, err := New("cid", "secret", "http://localhost/callback",
+		WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+		WithRetry(NoRetry))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.SetToken(newTestToken("363"))
+	c.MeasureURL = ts.URL
+
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	c.MeasureURL = ts.URL + "/unknown\x7f"
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err == nil {
+		t.Fatal("GetMeas with the invalid url returns no error")
+	}
+	c.PrintToken()
+
+	for _, want := range []string{
+		`level=DEBUG msg="withings api call" action=getmeas attempts=1`,
+		"more=true offset=3",
+		`level=WARN msg="withings api call gave up" action=getmeas attempts=1`,
+		`level=INFO msg="withings token"`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not have %q:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,30 @@
+module github.com/zono-dev/withings-go/withings/otelwithings
+
+go 1.24
+
+require (
+	github.com/zono-dev/withings-go/withings v0.0.0-20261017090812-523aa406c5d1
+	go.opentelemetry.io/otel v1.38.0
+	go.opentelemetry.io/otel/sdk v1.38.0
+	go.opentelemetry.io/otel/trace v1.38.0
+	golang.org/x/oauth2 v0.0.0-20201208152858-08078c50e5b5
+)
+
+require (
+	github.com/go-logr/logr v1.4.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel/metric v1.38.0 // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	google.golang.org/appengine v1.6.6 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+
+// The integration is developed together with the library. Replace directives are ignored
+// by the dependents, so they get the library version required above.
+replace github.com/zono-dev/withings-go/withings => ../
@@ -0,0 +1,151 @@
+// Package otelwithings instruments withings clients with OpenTelemetry tracing.
+//
+// Every API call gets a span named after its action (e.g. "withings getmeas"),
+// and every token request gets a "withings requesttoken" span.
+//
+//	client, err := withings.New(cid, secret, redirectURL, otelwithings.Instrument())
+package otelwithings
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zono-dev/withings-go/withings"
+)
+
+// instrumentationName is the name of the tracer.
+const instrumentationName = "github.com/zono-dev/withings-go/withings/otelwithings"
+
+// Attribute keys of the spans.
+const (
+	ActionKey     = attribute.Key("withings.action")
+	DataFieldsKey = attribute.Key("withings.data_fields")
+	StartDateKey  = attribute.Key("withings.startdate")
+	EndDateKey    = attribute.Key("withings.enddate")
+	LastUpdateKey = attribute.Key("withings.lastupdate")
+	OffsetKey     = attribute.Key("withings.offset")
+	StatusKey     = attribute.Key("withings.status")
+	RetryCountKey = attribute.Key("withings.retry_count")
+	GrantTypeKey  = attribute.Key("withings.grant_type")
+	HTTPStatusKey = attribute.Key("http.response.status_code")
+)
+
+type config struct {
+	tp trace.TracerProvider
+}
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+// WithTracerProvider sets the TracerProvider. The global TracerProvider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tp = tp
+	}
+}
+
+func newTracer(opts []Option) trace.Tracer {
+	c := &config{}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.tp == nil {
+		c.tp = otel.GetTracerProvider()
+	}
+	return c.tp.Tracer(instrumentationName)
+}
+
+// Instrument returns withings.ClientOption which traces API calls and token refreshes of the client.
+func Instrument(opts ...Option) withings.ClientOption {
+	return func(c *withings.Client) error {
+		c.Observe(CallObserver(opts...))
+		c.Use(Middleware(opts...))
+		return nil
+	}
+}
+
+// CallObserver returns withings.CallObserver which starts a span for each API call.
+func CallObserver(opts ...Option) withings.CallObserver {
+	tracer := newTracer(opts)
+	return func(ctx context.Context, call *withings.Call) (context.Context, func()) {
+		ctx, span := tracer.Start(ctx, "withings "+call.Action,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(callAttributes(call)...))
+		return ctx, func() {
+			span.SetAttributes(
+				StatusKey.Int(call.Status),
+				RetryCountKey.Int(max(call.Attempts-1, 0)),
+			)
+			if call.Err != nil {
+				span.RecordError(call.Err)
+				span.SetStatus(codes.Error, call.Err.Error())
+			}
+			span.End()
+		}
+	}
+}
+
+// callAttributes returns the attributes of the parameters of call.
+func callAttributes(call *withings.Call) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{ActionKey.String(call.Action)}
+	p := call.Params
+	add := func(key attribute.Key, names ...string) {
+		for _, name := range names {
+			if v := p.Get(name); v != "" {
+				attrs = append(attrs, key.String(v))
+				return
+			}
+		}
+	}
+	add(DataFieldsKey, withings.PPdataFields, withings.PPmeastype)
+	add(StartDateKey, withings.PPstartdate, withings.PPstartdateymd)
+	add(EndDateKey, withings.PPenddate, withings.PPenddateymd)
+	add(LastUpdateKey, withings.PPlastupdate)
+	if v, err := strconv.Atoi(p.Get(withings.PPoffset)); err == nil {
+		attrs = append(attrs, OffsetKey.Int(v))
+	}
+	return attrs
+}
+
+// Middleware returns withings.Middleware which starts a span for each token request,
+// i.e. the exchange of the grant code and the refresh of the token.
+// Other requests are passed through since they are traced by CallObserver.
+func Middleware(opts ...Option) withings.Middleware {
+	tracer := newTracer(opts)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return withings.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if withings.ActionFromContext(req.Context()) != withings.RequestTokenA {
+				return next.RoundTrip(req)
+			}
+
+			ctx, span := tracer.Start(req.Context(), "withings "+withings.RequestTokenA,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(ActionKey.String(withings.RequestTokenA)))
+			defer span.End()
+			if req.PostForm != nil {
+				span.SetAttributes(GrantTypeKey.String(req.PostForm.Get("grant_type")))
+			}
+
+			resp, err := next.RoundTrip(req.WithContext(ctx))
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return nil, err
+			}
+			span.SetAttributes(HTTPStatusKey.Int(resp.StatusCode))
+			if status, ok := withings.ResponseStatus(resp); ok {
+				span.SetAttributes(StatusKey.Int(status))
+				if status != 0 {
+					span.SetStatus(codes.Error, "withings status "+strconv.Itoa(status))
+				}
+			}
+			return resp, nil
+		})
+	}
+}
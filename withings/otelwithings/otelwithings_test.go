@@ -0,0 +1,115 @@
+package otelwithings
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/oauth2"
+
+	"github.com/zono-dev/withings-go/withings"
+	"github.com/zono-dev/withings-go/withings/internal/fakeapi"
+)
+
+func newClient(t *testing.T, url string, tp *sdktrace.TracerProvider) *withings.Client {
+	c, err := withings.New("cid", "secret", "http://localhost/callback",
+		withings.WithBaseURL(url),
+		withings.WithRetry(withings.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		Instrument(WithTracerProvider(tp)))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	expired := &oauth2.Token{AccessToken: "expired", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)}
+	c.SetToken(expired.WithExtra(map[string]interface{}{"userid": "363"}))
+	return c
+}
+
+func attrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestInstrument(t *testing.T) {
+	ts := fakeapi.NewServer(601, 1)
+	defer ts.Close()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	c := newClient(t, ts.URL, tp)
+	start := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	if _, err := c.GetMeas(withings.Real, start, end, withings.OffsetBase, 20, false, false, withings.Weight, withings.Height); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+
+	spans := exp.GetSpans().Snapshots()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	refresh, call := spans[0], spans[1]
+
+	if call.Name() != "withings getmeas" {
+		t.Errorf("span name = %s, want withings getmeas", call.Name())
+	}
+	a := attrs(call)
+	want := map[attribute.Key]attribute.Value{
+		ActionKey:     attribute.StringValue("getmeas"),
+		DataFieldsKey: attribute.StringValue("1,4"),
+		StartDateKey:  attribute.StringValue(fmt.Sprint(start.Unix())),
+		EndDateKey:    attribute.StringValue(fmt.Sprint(end.Unix())),
+		OffsetKey:     attribute.IntValue(20),
+		StatusKey:     attribute.IntValue(0),
+		RetryCountKey: attribute.IntValue(1),
+	}
+	for k, v := range want {
+		if a[k] != v {
+			t.Errorf("attribute %s = %v, want %v", k, a[k].Emit(), v.Emit())
+		}
+	}
+	if call.Status().Code == codes.Error {
+		t.Errorf("span status = %v, want not error", call.Status())
+	}
+
+	if refresh.Name() != "withings requesttoken" {
+		t.Errorf("span name = %s, want withings requesttoken", refresh.Name())
+	}
+	if refresh.Parent().SpanID() != call.SpanContext().SpanID() {
+		t.Error("token refresh span is not a child of the call span")
+	}
+	a = attrs(refresh)
+	if a[GrantTypeKey].AsString() != "refresh_token" || a[StatusKey].AsInt64() != 0 || a[HTTPStatusKey].AsInt64() != 200 {
+		t.Errorf("token refresh span attributes = %v", refresh.Attributes())
+	}
+}
+
+func TestInstrumentError(t *testing.T) {
+	ts := fakeapi.NewServer(2555, 5)
+	defer ts.Close()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	c := newClient(t, ts.URL, tp)
+	if _, err := c.GetActivity("2020-07-01", "2020-07-02", 0, 0, withings.Steps); err == nil {
+		t.Fatal("GetActivity returns no error")
+	}
+
+	spans := exp.GetSpans().Snapshots()
+	call := spans[len(spans)-1]
+	if call.Name() != "withings getactivity" {
+		t.Fatalf("span name = %s, want withings getactivity", call.Name())
+	}
+	a := attrs(call)
+	if a[StatusKey].AsInt64() != 2555 || a[RetryCountKey].AsInt64() != 2 || a[StartDateKey].AsString() != "2020-07-01" {
+		t.Errorf("span attributes = %v", call.Attributes())
+	}
+	if call.Status().Code != codes.Error || len(call.Events()) == 0 {
+		t.Errorf("span status = %v with %d events, want error recorded", call.Status(), len(call.Events()))
+	}
+}
@@ -0,0 +1,29 @@
+module github.com/zono-dev/withings-go/withings/promwithings
+
+go 1.24
+
+require (
+	github.com/prometheus/client_golang v1.11.1
+	github.com/zono-dev/withings-go/withings v0.0.0-20261017090812-523aa406c5d1
+	golang.org/x/oauth2 v0.0.0-20201208152858-08078c50e5b5
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/golang/protobuf v1.5.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_model v0.6.2 // indirect
+	github.com/prometheus/common v0.26.0 // indirect
+	github.com/prometheus/procfs v0.16.1 // indirect
+	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	google.golang.org/appengine v1.6.6 // indirect
+	google.golang.org/protobuf v1.36.8 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+
+// The integration is developed together with the library. Replace directives are ignored
+// by the dependents, so they get the library version required above.
+replace github.com/zono-dev/withings-go/withings => ../
@@ -0,0 +1,153 @@
+// Package promwithings collects Prometheus metrics of withings clients.
+//
+//	collector := promwithings.NewCollector()
+//	prometheus.MustRegister(collector)
+//	client, err := withings.New(cid, secret, redirectURL, collector.Instrument())
+//
+// The metrics are:
+//
+//	withings_calls_total{action,status}               API calls by the withings status ("error" if no response)
+//	withings_call_duration_seconds{action}            latency of API calls including retries
+//	withings_requests_total{action,code}              HTTP requests including retries and token requests
+//	withings_retries_total{action}                    retried requests of API calls
+//	withings_rate_limit_wait_seconds{action}          time API calls waited for the rate limiter
+//	withings_token_refreshes_total{grant_type,status} token requests by the withings status
+package promwithings
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zono-dev/withings-go/withings"
+)
+
+const namespace = "withings"
+
+// Collector is prometheus.Collector of withings clients.
+// Share one Collector among the clients of an app.
+type Collector struct {
+	calls         *prometheus.CounterVec
+	callDuration  *prometheus.HistogramVec
+	requests      *prometheus.CounterVec
+	retries       *prometheus.CounterVec
+	rateLimitWait *prometheus.HistogramVec
+	refreshes     *prometheus.CounterVec
+}
+
+// NewCollector returns new Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "calls_total",
+			Help:      "Number of withings API calls by action and withings status.",
+		}, []string{"action", "status"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "call_duration_seconds",
+			Help:      "Latency of withings API calls including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"action"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests to withings by action and HTTP status code.",
+		}, []string{"action", "code"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Number of retried requests of withings API calls.",
+		}, []string{"action"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_wait_seconds",
+			Help:      "Time withings API calls waited for the rate limiter.",
+			Buckets:   []float64{0, .01, .1, .5, 1, 5, 10, 30, 60},
+		}, []string{"action"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "Number of withings token requests by grant type and withings status.",
+		}, []string{"grant_type", "status"}),
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.calls, c.callDuration, c.requests, c.retries, c.rateLimitWait, c.refreshes}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// Instrument returns withings.ClientOption which collects the metrics of the client.
+func (c *Collector) Instrument() withings.ClientOption {
+	return func(client *withings.Client) error {
+		client.Observe(c.CallObserver())
+		client.Use(c.Middleware())
+		return nil
+	}
+}
+
+// CallObserver returns withings.CallObserver which collects the metrics of API calls.
+func (c *Collector) CallObserver() withings.CallObserver {
+	return func(ctx context.Context, call *withings.Call) (context.Context, func()) {
+		start := time.Now()
+		return ctx, func() {
+			status := strconv.Itoa(call.Status)
+			if call.Err != nil && call.Status == 0 {
+				status = "error"
+			}
+			c.calls.WithLabelValues(call.Action, status).Inc()
+			c.callDuration.WithLabelValues(call.Action).Observe(time.Since(start).Seconds())
+			if call.Attempts > 1 {
+				c.retries.WithLabelValues(call.Action).Add(float64(call.Attempts - 1))
+			}
+			c.rateLimitWait.WithLabelValues(call.Action).Observe(call.RateLimitWait.Seconds())
+		}
+	}
+}
+
+// Middleware returns withings.Middleware which counts HTTP requests and token requests.
+func (c *Collector) Middleware() withings.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return withings.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			action := withings.ActionFromContext(req.Context())
+			resp, err := next.RoundTrip(req)
+			code := "error"
+			if err == nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			c.requests.WithLabelValues(action, code).Inc()
+
+			if action == withings.RequestTokenA {
+				var grantType string
+				if req.PostForm != nil {
+					grantType = req.PostForm.Get("grant_type")
+				}
+				status := "error"
+				if err == nil {
+					if s, ok := withings.ResponseStatus(resp); ok {
+						status = strconv.Itoa(s)
+					}
+				}
+				c.refreshes.WithLabelValues(grantType, status).Inc()
+			}
+			return resp, err
+		})
+	}
+}
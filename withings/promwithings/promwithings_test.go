@@ -0,0 +1,90 @@
+package promwithings
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/oauth2"
+
+	"github.com/zono-dev/withings-go/withings"
+	"github.com/zono-dev/withings-go/withings/internal/fakeapi"
+)
+
+func TestCollector(t *testing.T) {
+	ts := fakeapi.NewServer(601, 1)
+	defer ts.Close()
+
+	collector := NewCollector()
+	c, err := withings.New("cid", "secret", "http://localhost/callback",
+		withings.WithBaseURL(ts.URL),
+		withings.WithRetry(withings.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		withings.WithRateLimiter(withings.NewRateLimiter(withings.DefaultAppLimit, withings.Limit{})),
+		collector.Instrument())
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	expired := &oauth2.Token{AccessToken: "expired", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)}
+	c.SetToken(expired.WithExtra(map[string]interface{}{"userid": "363"}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetMeas(withings.Real, time.Now().Add(-24*time.Hour), time.Now(), withings.OffsetBase, 0, false, false, withings.Weight); err != nil {
+			t.Fatalf("GetMeas returns error(%v)", err)
+		}
+	}
+
+	expected := `
+# HELP withings_calls_total Number of withings API calls by action and withings status.
+# TYPE withings_calls_total counter
+withings_calls_total{action="getmeas",status="0"} 2
+# HELP withings_requests_total Number of HTTP requests to withings by action and HTTP status code.
+# TYPE withings_requests_total counter
+withings_requests_total{action="getmeas",code="200"} 3
+withings_requests_total{action="requesttoken",code="200"} 1
+# HELP withings_retries_total Number of retried requests of withings API calls.
+# TYPE withings_retries_total counter
+withings_retries_total{action="getmeas"} 1
+# HELP withings_token_refreshes_total Number of withings token requests by grant type and withings status.
+# TYPE withings_token_refreshes_total counter
+withings_token_refreshes_total{grant_type="refresh_token",status="0"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"withings_calls_total", "withings_requests_total", "withings_retries_total", "withings_token_refreshes_total"); err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(collector, "withings_call_duration_seconds", "withings_rate_limit_wait_seconds"); n != 2 {
+		t.Errorf("got %d histograms, want 2", n)
+	}
+	problems, err := testutil.CollectAndLint(collector)
+	if err != nil {
+		t.Fatalf("CollectAndLint returns error(%v)", err)
+	}
+	for _, p := range problems {
+		t.Errorf("lint %s: %s", p.Metric, p.Text)
+	}
+}
+
+func TestCollectorError(t *testing.T) {
+	ts := fakeapi.NewServer(2555, 5)
+	defer ts.Close()
+
+	collector := NewCollector()
+	c, err := withings.New("cid", "secret", "http://localhost/callback",
+		withings.WithBaseURL(ts.URL), withings.WithRetry(withings.NoRetry), collector.Instrument())
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.SetToken(&oauth2.Token{AccessToken: "access-0", Expiry: time.Now().Add(time.Hour)})
+
+	if _, err := c.GetMeas(withings.Real, time.Now().Add(-24*time.Hour), time.Now(), withings.OffsetBase, 0, false, false, withings.Weight); err == nil {
+		t.Fatal("GetMeas returns no error")
+	}
+	if got := testutil.ToFloat64(collector.calls.WithLabelValues("getmeas", "2555")); got != 1 {
+		t.Errorf("withings_calls_total{status=2555} = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(collector, "withings_retries_total"); got != 0 {
+		t.Errorf("got %d retries series, want 0", got)
+	}
+}
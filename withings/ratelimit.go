@@ -0,0 +1,201 @@
+package withings
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a request quota: at most Requests requests Per the duration.
+// The zero value means no limit.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// DefaultAppLimit is the request quota of a withings app (120 requests per minute).
+var DefaultAppLimit = Limit{Requests: 120, Per: time.Minute}
+
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// perSecond returns the refill rate of the bucket.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Clock is the time source of RateLimiter. Tests inject a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// bucket is a token bucket which is full at first.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(l Limit, now time.Time) *bucket {
+	return &bucket{tokens: float64(l.Requests), last: now}
+}
+
+// refill adds the tokens since the last refill.
+func (b *bucket) refill(l Limit, now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(l.Requests), b.tokens+now.Sub(b.last).Seconds()*l.perSecond())
+		b.last = now
+	}
+}
+
+// wait returns how long to wait until the bucket has a token.
+func (b *bucket) wait(l Limit) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) / l.perSecond() * float64(time.Second)))
+}
+
+// RateLimiter throttles requests with token buckets for the app and for each user.
+// Share one RateLimiter among all clients of the app, since withings counts requests per app.
+// RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	app   Limit
+	user  Limit
+	clock Clock
+
+	mu        sync.Mutex
+	appBucket *bucket
+	users     map[string]*bucket
+}
+
+// NewRateLimiter returns RateLimiter with the quota of the app and the quota of each user.
+// Pass the zero Limit not to limit either of them.
+func NewRateLimiter(app, user Limit) *RateLimiter {
+	return NewRateLimiterWithClock(app, user, systemClock{})
+}
+
+// NewRateLimiterWithClock returns RateLimiter which uses clock instead of the system clock.
+func NewRateLimiterWithClock(app, user Limit, clock Clock) *RateLimiter {
+	return &RateLimiter{
+		app:   app,
+		user:  user,
+		clock: clock,
+		users: map[string]*bucket{},
+	}
+}
+
+// buckets returns the refilled buckets for userid. Either of them is nil if it is not limited.
+// l.mu must be held.
+func (l *RateLimiter) buckets(userid string, now time.Time) (app, user *bucket) {
+	if !l.app.unlimited() {
+		if l.appBucket == nil {
+			l.appBucket = newBucket(l.app, now)
+		}
+		app = l.appBucket
+		app.refill(l.app, now)
+	}
+	if !l.user.unlimited() && userid != "" {
+		user = l.users[userid]
+		if user == nil {
+			user = newBucket(l.user, now)
+			l.users[userid] = user
+		}
+		user.refill(l.user, now)
+	}
+	return app, user
+}
+
+// reserve takes a token from the buckets of userid if both have one.
+// Otherwise it returns how long to wait.
+func (l *RateLimiter) reserve(userid string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	app, user := l.buckets(userid, l.clock.Now())
+	var d time.Duration
+	if app != nil {
+		d = app.wait(l.app)
+	}
+	if user != nil {
+		if ud := user.wait(l.user); ud > d {
+			d = ud
+		}
+	}
+	if d > 0 {
+		return d
+	}
+	if app != nil {
+		app.tokens--
+	}
+	if user != nil {
+		user.tokens--
+	}
+	return 0
+}
+
+// Wait blocks until a request of userid is allowed, or returns the error of ctx when ctx is done first.
+// The quota of each user is not applied if userid is empty.
+func (l *RateLimiter) Wait(ctx context.Context, userid string) error {
+	for {
+		d := l.reserve(userid)
+		if d == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.clock.After(d):
+		}
+	}
+}
+
+// AppBudget returns the number of requests the app can make now. It is +Inf if the app is not limited.
+func (l *RateLimiter) AppBudget() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	app, _ := l.buckets("", l.clock.Now())
+	if app == nil {
+		return math.Inf(1)
+	}
+	return app.tokens
+}
+
+// UserBudget returns the number of requests userid can make now regardless of the app's quota.
+// It is +Inf if users are not limited.
+func (l *RateLimiter) UserBudget(userid string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, user := l.buckets(userid, l.clock.Now())
+	if user == nil {
+		return math.Inf(1)
+	}
+	return user.tokens
+}
+
+type rateLimitedKey struct{}
+
+// waitRateLimit waits for the rate limiter of the client and returns ctx marked as already waited,
+// so Do does not wait again, and how long it waited.
+func (c *Client) waitRateLimit(ctx context.Context) (context.Context, time.Duration, error) {
+	l := c.RateLimiter
+	if l == nil || ctx.Value(rateLimitedKey{}) != nil {
+		return ctx, 0, nil
+	}
+	start := l.clock.Now()
+	err := l.Wait(ctx, TokenUserID(c.CurrentToken()))
+	waited := l.clock.Now().Sub(start)
+	if err != nil {
+		return ctx, waited, err
+	}
+	return context.WithValue(ctx, rateLimitedKey{}, true), waited, nil
+}
@@ -0,0 +1,169 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which moves only by Advance.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	// waiting receives the duration whenever After is called.
+	waiting chan time.Duration
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), waiting: make(chan time.Duration, 10)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	c.mu.Unlock()
+	c.waiting <- d
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiterWithClock(Limit{Requests: 2, Per: time.Minute}, Limit{}, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, "363"); err != nil {
+			t.Fatalf("Wait returns error(%v)", err)
+		}
+	}
+	if got := l.AppBudget(); got != 0 {
+		t.Errorf("AppBudget = %v, want 0", got)
+	}
+
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx, "363") }()
+
+	// One request is refilled every 30 seconds.
+	if d := <-clock.waiting; d != 30*time.Second {
+		t.Errorf("Wait waits %v, want 30s", d)
+	}
+	select {
+	case <-done:
+		t.Fatal("Wait returned before the bucket is refilled")
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Wait returns error(%v)", err)
+	}
+	if got := l.AppBudget(); got != 0 {
+		t.Errorf("AppBudget = %v, want 0", got)
+	}
+
+	clock.Advance(time.Hour)
+	if got := l.AppBudget(); got != 2 {
+		t.Errorf("AppBudget = %v, want 2 (full)", got)
+	}
+}
+
+func TestRateLimiterPerUser(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiterWithClock(Limit{Requests: 10, Per: time.Minute}, Limit{Requests: 1, Per: time.Minute}, clock)
+
+	if err := l.Wait(context.Background(), "a"); err != nil {
+		t.Fatalf("Wait returns error(%v)", err)
+	}
+	if err := l.Wait(context.Background(), "b"); err != nil {
+		t.Fatalf("Wait returns error(%v)", err)
+	}
+	if got := l.UserBudget("a"); got != 0 {
+		t.Errorf("UserBudget(a) = %v, want 0", got)
+	}
+	if got := l.UserBudget("c"); got != 1 {
+		t.Errorf("UserBudget(c) = %v, want 1", got)
+	}
+	if got := l.AppBudget(); got != 8 {
+		t.Errorf("AppBudget = %v, want 8", got)
+	}
+
+	// The user's quota is exhausted, so Wait blocks until ctx is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx, "a") }()
+	if d := <-clock.waiting; d != time.Minute {
+		t.Errorf("Wait waits %v, want 1m", d)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait returns error(%v), want context.Canceled", err)
+	}
+	// The canceled request did not take the app's quota.
+	if got := l.AppBudget(); got != 8 {
+		t.Errorf("AppBudget = %v, want 8", got)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := NewRateLimiterWithClock(Limit{}, Limit{}, newFakeClock())
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(context.Background(), "363"); err != nil {
+			t.Fatalf("Wait returns error(%v)", err)
+		}
+	}
+	if got := l.AppBudget(); !math.IsInf(got, 1) {
+		t.Errorf("AppBudget = %v, want +Inf", got)
+	}
+	if got := l.UserBudget("363"); !math.IsInf(got, 1) {
+		t.Errorf("UserBudget = %v, want +Inf", got)
+	}
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	c := newFakeClient(t, fs)
+	c.RateLimiter = NewRateLimiterWithClock(Limit{Requests: 5, Per: time.Minute}, Limit{Requests: 5, Per: time.Minute}, newFakeClock())
+
+	if _, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight); err != nil {
+		t.Fatalf("GetMeas returns error(%v)", err)
+	}
+	// The token refresh is not counted.
+	if got := c.RateLimiter.AppBudget(); got != 4 {
+		t.Errorf("AppBudget = %v, want 4", got)
+	}
+	if got := c.RateLimiter.UserBudget("363"); got != 4 {
+		t.Errorf("UserBudget = %v, want 4", got)
+	}
+}
@@ -0,0 +1,113 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// RetryPolicy decides whether and when failed API calls are retried.
+// All current actions only read data, so retrying them is safe.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one. 1 or less means no retry.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles for every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay. No cap if zero.
+	MaxDelay time.Duration
+	// Retryable reports whether err is worth retrying. IsRetryable is used if nil.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is the retry policy of clients created by New.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// NoRetry is the retry policy which never retries.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// IsRetryable reports whether err is transient:
+// withings rate limited the request or failed by itself, or the request timed out.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) {
+		return true
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	// Client.Timeout of an attempt
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// delay returns the delay before the retry after attempt with jitter.
+// It is between the half and the whole of the exponential backoff.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a context which overrides the retry policy of the client for calls made with it.
+func WithRetryPolicy(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// retryPolicy returns the retry policy for a call with ctx.
+func (c *Client) retryPolicy(ctx context.Context) RetryPolicy {
+	if p, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy); ok {
+		return p
+	}
+	return c.RetryPolicy
+}
+
+// retry calls f until it succeeds or p gives up.
+// It does not retry after ctx is done nor when the delay exceeds the deadline of ctx.
+func retry(ctx context.Context, p RetryPolicy, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+		// The callback already got a part of the result.
+		var perr *partialError
+		if errors.As(err, &perr) {
+			return err
+		}
+
+		d := p.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return err
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns the measure api which fails with status for the first failures requests.
+func newFlakyServer(t *testing.T, status, failures int32) (*httptest.Server, *int32) {
+	jsonBlob, err := ioutil.ReadFile(testMeasureFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile returns error(%v)", err)
+	}
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&requests, 1) <= failures {
+			fmt.Fprintf(w, `{"status":%d,"body":{},"error":"failed"}`, status)
+			return
+		}
+		w.Write(jsonBlob)
+	}))
+	return ts, &requests
+}
+
+func TestRetry(t *testing.T) {
+	fs := newFakeServer(t)
+	defer fs.Close()
+
+	tests := []struct {
+		name         string
+		status       int32
+		failures     int32
+		wantErr      error
+		wantRequests int32
+	}{
+		{"rate limited then success", 601, 2, nil, 3},
+		{"server error until give up", 2555, 5, ErrServerError, 3},
+		{"invalid params is not retried", 503, 5, ErrInvalidParams, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := newFlakyServer(t, tt.status, tt.failures)
+			defer ts.Close()
+
+			c := newFakeClient(t, fs)
+			c.MeasureURL = ts.URL
+			c.RetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+			_, err := c.GetMeas(Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, false, false, Weight)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("GetMeas returns error(%v)", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetMeas returns error(%v), want %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(requests); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpBeforeDeadline(t *testing.T) {
+	var calls int
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}
+
+	err := retry(ctx, p, func() error {
+		calls++
+		return &APIError{Status: 601}
+	})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("retry returns error(%v), want ErrRateLimited", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 150 * time.Millisecond, 300 * time.Millisecond},
+		{10, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	c := &Client{RetryPolicy: DefaultRetryPolicy}
+	if got := c.retryPolicy(context.Background()); got.MaxAttempts != DefaultRetryPolicy.MaxAttempts {
+		t.Errorf("retryPolicy = %+v, want DefaultRetryPolicy", got)
+	}
+	ctx := WithRetryPolicy(context.Background(), NoRetry)
+	if got := c.retryPolicy(ctx); got.MaxAttempts != 1 {
+		t.Errorf("retryPolicy with context = %+v, want NoRetry", got)
+	}
+}
@@ -0,0 +1,101 @@
+package withings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// Scope is oauth2 scope of withings api.
+type Scope string
+
+// ErrInsufficientScope matches InsufficientScopeError with errors.Is.
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// InsufficientScopeError is returned before sending a request when the token was not granted the scope the API needs.
+type InsufficientScopeError struct {
+	Method   string
+	Required Scope
+	Granted  []Scope
+}
+
+func (e *InsufficientScopeError) Error() string {
+	return fmt.Sprintf("%s needs scope %s, but the token has %s", e.Method, e.Required, joinScopes(e.Granted))
+}
+
+// Is reports whether target is ErrInsufficientScope.
+func (e *InsufficientScopeError) Is(target error) bool {
+	return target == ErrInsufficientScope
+}
+
+// methodScopes is the scope which each API method needs.
+var methodScopes = map[string]Scope{
+	"GetMeas":         ScopeMetrics,
+	"GetActivity":     ScopeActivity,
+	"GetWorkouts":     ScopeActivity,
+	"GetSleep":        ScopeActivity,
+	"GetSleepSummary": ScopeActivity,
+}
+
+// RequiredScope returns the scope which API method (e.g. "GetMeas") needs.
+func RequiredScope(method string) (Scope, bool) {
+	s, ok := methodScopes[method]
+	return s, ok
+}
+
+// ParseScopes parses comma (or space) separated scopes.
+func ParseScopes(s string) []Scope {
+	scopes := []Scope{}
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		scopes = append(scopes, Scope(v))
+	}
+	return scopes
+}
+
+// joinScopes joins scopes with comma as withings expects.
+func joinScopes(scopes []Scope) string {
+	ss := make([]string, len(scopes))
+	for i, s := range scopes {
+		ss[i] = string(s)
+	}
+	return strings.Join(ss, ",")
+}
+
+// TokenScopes returns the scopes granted to the token.
+// ok is false if the token does not have scope in its extras, e.g. a token file saved by older versions.
+func TokenScopes(t *oauth2.Token) (scopes []Scope, ok bool) {
+	if t == nil {
+		return nil, false
+	}
+	s, ok := t.Extra("scope").(string)
+	if !ok || s == "" {
+		return nil, false
+	}
+	return ParseScopes(s), true
+}
+
+// HasScope reports whether scopes contains s.
+func HasScope(scopes []Scope, s Scope) bool {
+	for _, v := range scopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkScope returns InsufficientScopeError if the token was not granted the scope method needs.
+// It does nothing if the granted scopes are unknown.
+func (c *Client) checkScope(method string) error {
+	required, ok := RequiredScope(method)
+	if !ok {
+		return nil
+	}
+	granted, ok := TokenScopes(c.CurrentToken())
+	if !ok || HasScope(granted, required) {
+		return nil
+	}
+	return &InsufficientScopeError{Method: method, Required: required, Granted: granted}
+}
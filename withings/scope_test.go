@@ -0,0 +1,49 @@
+package withings
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestParseScopes(t *testing.T) {
+	got := ParseScopes("user.info,user.metrics user.activity")
+	want := []Scope{ScopeInfo, ScopeMetrics, ScopeActivity}
+	if len(got) != len(want) {
+		t.Fatalf("ParseScopes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParseScopes = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestInsufficientScope(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("request was sent with insufficient scope")
+		}))
+	defer ts.Close()
+
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.SleepURLv2 = ts.URL
+	tk := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+	c.SetToken(tk.WithExtra(map[string]interface{}{"scope": "user.info,user.metrics"}))
+
+	_, err = c.GetSleep(time.Now().Add(-24*time.Hour), time.Now(), HrSleep)
+	if !errors.Is(err, ErrInsufficientScope) {
+		t.Fatalf("GetSleep returns error(%v), want %v", err, ErrInsufficientScope)
+	}
+	var serr *InsufficientScopeError
+	if !errors.As(err, &serr) || serr.Required != ScopeActivity {
+		t.Errorf("GetSleep returns error(%#v), want InsufficientScopeError for %s", err, ScopeActivity)
+	}
+}
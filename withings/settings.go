@@ -0,0 +1,206 @@
+package withings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Environment variables read by LoadSettings and SettingsFromEnv.
+// They override the values in the settings file.
+const (
+	EnvClientID     = "WITHINGS_CLIENT_ID"
+	EnvClientSecret = "WITHINGS_CLIENT_SECRET"
+	EnvRedirectURL  = "WITHINGS_REDIRECT_URL"
+	EnvScopes       = "WITHINGS_SCOPES" // comma separated
+)
+
+// Settings is the settings of your withings app.
+type Settings struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes is optional. The default scopes of GetNewConf are used if it is empty.
+	Scopes []Scope
+}
+
+// LoadSettings reads the settings file which is yaml or json file (by its extension),
+// overrides the values with environment variables and validates them.
+// Keys are case-insensitive and "_" and "-" in keys are ignored,
+// so both `CID: xxx` and `cid: xxx`, `RedirectURL` and `redirect_url` are accepted.
+func LoadSettings(path2settings string) (*Settings, error) {
+	b, err := ioutil.ReadFile(path2settings)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(path2settings), ".json") {
+		// numbers are kept as they are, e.g. client ids of numbers only
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		err = d.Decode(&m)
+	} else {
+		err = yaml.Unmarshal(b, &m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode settings file %s: %w", path2settings, err)
+	}
+
+	s := &Settings{}
+	if err := s.setValues(m); err != nil {
+		return nil, fmt.Errorf("invalid settings file %s: %w", path2settings, err)
+	}
+	s.ApplyEnv()
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadSettings reads the settings file with LoadSettings and returns the settings as the map of CID, Secret and RedirectURL.
+// It returns nil if the settings cannot be loaded.
+//
+// Deprecated: ReadSettings hides the error. Use LoadSettings instead.
+func ReadSettings(path2settings string) map[string]string {
+	s, err := LoadSettings(path2settings)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{
+		"CID":         s.ClientID,
+		"Secret":      s.ClientSecret,
+		"RedirectURL": s.RedirectURL,
+	}
+}
+
+// SettingsFromEnv returns the settings read from environment variables and validates them.
+func SettingsFromEnv() (*Settings, error) {
+	s := &Settings{}
+	s.ApplyEnv()
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// normalizeKey makes settings keys case-insensitive and ignores "_" and "-".
+func normalizeKey(k string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(k))
+}
+
+// setValues sets the values of the settings file.
+func (s *Settings) setValues(m map[string]interface{}) error {
+	for k, v := range m {
+		var err error
+		switch normalizeKey(k) {
+		case "cid", "clientid":
+			s.ClientID, err = settingString(k, v)
+		case "secret", "clientsecret", "consumersecret":
+			s.ClientSecret, err = settingString(k, v)
+		case "redirecturl", "redirecturi", "callbackurl":
+			s.RedirectURL, err = settingString(k, v)
+		case "scope", "scopes":
+			s.Scopes, err = settingScopes(k, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func settingString(k string, v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		// client ids of numbers only
+		return val.String(), nil
+	case int, int64, uint64:
+		return fmt.Sprint(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	}
+	return "", errors.Errorf("%s must be string, got %T", k, v)
+}
+
+func settingScopes(k string, v interface{}) ([]Scope, error) {
+	switch val := v.(type) {
+	case string:
+		return ParseScopes(val), nil
+	case []interface{}:
+		scopes := []Scope{}
+		for _, e := range val {
+			str, err := settingString(k, e)
+			if err != nil {
+				return nil, err
+			}
+			scopes = append(scopes, ParseScopes(str)...)
+		}
+		return scopes, nil
+	}
+	return nil, errors.Errorf("%s must be string or list of string, got %T", k, v)
+}
+
+// ApplyEnv overrides the settings with environment variables which are set.
+func (s *Settings) ApplyEnv() {
+	if v := os.Getenv(EnvClientID); v != "" {
+		s.ClientID = v
+	}
+	if v := os.Getenv(EnvClientSecret); v != "" {
+		s.ClientSecret = v
+	}
+	if v := os.Getenv(EnvRedirectURL); v != "" {
+		s.RedirectURL = v
+	}
+	if v := os.Getenv(EnvScopes); v != "" {
+		s.Scopes = ParseScopes(v)
+	}
+}
+
+// Validate checks that the required settings are set and RedirectURL is an absolute http(s) URL.
+func (s *Settings) Validate() error {
+	var problems []string
+	if s.ClientID == "" {
+		problems = append(problems, "client id is empty")
+	}
+	if s.ClientSecret == "" {
+		problems = append(problems, "client secret is empty")
+	}
+	if s.RedirectURL == "" {
+		problems = append(problems, "redirect url is empty")
+	} else if u, err := url.Parse(s.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("redirect url %q is not an absolute http(s) url", s.RedirectURL))
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid settings: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// NewFromSettings returns new client with the settings.
+func NewFromSettings(s *Settings, options ...ClientOption) (*Client, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	c, err := New(s.ClientID, s.ClientSecret, s.RedirectURL, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Scopes) > 0 {
+		c.SetScope(s.Scopes...)
+	}
+	return c, nil
+}
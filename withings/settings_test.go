@@ -0,0 +1,103 @@
+package withings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSettingsFile(t *testing.T, dir, name, body string) string {
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, []byte(body), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile returns error(%v)", err)
+	}
+	return p
+}
+
+func TestLoadSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withings")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returns error(%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		writeSettingsFile(t, dir, "cmd.yaml", "CID: \"id\"\nSecret: \"secret\"\nRedirectURL: \"https://example.com/\"\n"),
+		writeSettingsFile(t, dir, "test.yaml", "cid: id\nsecret: secret\nredirect_url: https://example.com/\n"),
+		writeSettingsFile(t, dir, "settings.json", `{"client_id":"id","client_secret":"secret","redirect_url":"https://example.com/","scopes":["user.info","user.metrics"]}`),
+	}
+	for _, f := range files {
+		s, err := LoadSettings(f)
+		if err != nil {
+			t.Errorf("LoadSettings(%s) returns error(%v)", f, err)
+			continue
+		}
+		if s.ClientID != "id" || s.ClientSecret != "secret" || s.RedirectURL != "https://example.com/" {
+			t.Errorf("LoadSettings(%s) = %+v", f, s)
+		}
+	}
+
+	os.Setenv(EnvClientSecret, "env-secret")
+	defer os.Unsetenv(EnvClientSecret)
+	s, err := LoadSettings(files[0])
+	if err != nil {
+		t.Fatalf("LoadSettings returns error(%v)", err)
+	}
+	if s.ClientSecret != "env-secret" {
+		t.Errorf("ClientSecret = %s, want env-secret", s.ClientSecret)
+	}
+}
+
+func TestLoadSettingsNumericID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withings")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returns error(%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{
+		writeSettingsFile(t, dir, "settings.json", `{"client_id":123456789,"client_secret":"secret","redirect_url":"https://example.com/"}`),
+		writeSettingsFile(t, dir, "settings.yaml", "cid: 123456789\nsecret: secret\nredirect_url: https://example.com/\n"),
+	} {
+		s, err := LoadSettings(f)
+		if err != nil {
+			t.Errorf("LoadSettings(%s) returns error(%v)", f, err)
+			continue
+		}
+		if s.ClientID != "123456789" {
+			t.Errorf("LoadSettings(%s) returns ClientID %q, want 123456789", f, s.ClientID)
+		}
+	}
+}
+
+func TestReadSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withings")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returns error(%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := writeSettingsFile(t, dir, "settings.yaml", "CID: \"id\"\nSecret: \"secret\"\nRedirectURL: \"https://example.com/\"\n")
+	m := ReadSettings(f)
+	if m["CID"] != "id" || m["Secret"] != "secret" || m["RedirectURL"] != "https://example.com/" {
+		t.Errorf("ReadSettings(%s) = %v", f, m)
+	}
+	if m := ReadSettings(filepath.Join(dir, "missing.yaml")); m != nil {
+		t.Errorf("ReadSettings of the missing file = %v, want nil", m)
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	s := &Settings{ClientID: "id", RedirectURL: "example.com"}
+	err := s.Validate()
+	if err == nil {
+		t.Fatalf("Validate returns no error")
+	}
+	for _, want := range []string{"client secret is empty", "not an absolute http(s) url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate returns error(%v), want it to contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package withings
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// ErrStateMismatch is returned when the state in the redirected request is not the one sent to withings.
+var ErrStateMismatch = errors.New("oauth2 state mismatch")
+
+// stateLength is the number of random bytes in a state.
+const stateLength = 32
+
+// NewState returns a cryptographically random state for an authorization attempt.
+func NewState() (string, error) {
+	b := make([]byte, stateLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "cannot generate state")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL to authorize with a newly generated state.
+// Keep the state and pass it to VerifyState or ExchangeCallback when withings redirects back.
+func AuthCodeURL(conf *oauth2.Config) (authURL, state string, err error) {
+	state, err = NewState()
+	if err != nil {
+		return "", "", err
+	}
+	return conf.AuthCodeURL(state, oauth2.AccessTypeOffline), state, nil
+}
+
+// VerifyState checks that the returned state got matches the state want sent to withings.
+func VerifyState(want, got string) error {
+	if want == "" || subtle.ConstantTimeCompare([]byte(want), []byte(got)) != 1 {
+		return ErrStateMismatch
+	}
+	return nil
+}
+
+// ExchangeCallback validates the query of the redirected request and exchanges the grant code for a token.
+// state is the state returned by AuthCodeURL. Every authorization flow shares this verification.
+// The token request is sent with the transport of *http.Client in ctx as oauth2.HTTPClient if it is set.
+func ExchangeCallback(ctx context.Context, conf *oauth2.Config, state string, query url.Values) (*oauth2.Token, error) {
+	if e := query.Get("error"); e != "" {
+		return nil, errors.Errorf("authorization failed: %s", e)
+	}
+	if err := VerifyState(state, query.Get("state")); err != nil {
+		return nil, err
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.Errorf("grant code is missing")
+	}
+
+	token, err := conf.Exchange(newOauthContext(ctx), code)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ExchangeCallback is ExchangeCallback with Conf and the transport of the client, including its middlewares,
+// and sets the token to the client.
+func (c *Client) ExchangeCallback(ctx context.Context, state string, query url.Values) (*oauth2.Token, error) {
+	token, err := ExchangeCallback(contextWithTransport(ctx, c.roundTripper()), c.Conf, state, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetToken(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
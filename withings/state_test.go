@@ -0,0 +1,66 @@
+package withings
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestNewState(t *testing.T) {
+	s1, err := NewState()
+	if err != nil {
+		t.Fatalf("NewState returns error(%v)", err)
+	}
+	s2, err := NewState()
+	if err != nil {
+		t.Fatalf("NewState returns error(%v)", err)
+	}
+	if s1 == s2 {
+		t.Errorf("NewState returns same state twice: %s", s1)
+	}
+}
+
+func TestVerifyState(t *testing.T) {
+	cases := []struct {
+		want, got string
+		ok        bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		err := VerifyState(c.want, c.got)
+		if (err == nil) != c.ok {
+			t.Errorf("VerifyState(%q, %q) = %v, want ok=%v", c.want, c.got, err, c.ok)
+		}
+	}
+}
+
+func TestExchangeCallback(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	conf := GetNewConf("cid", "secret", "http://localhost/callback")
+	conf.Endpoint.TokenURL = ts.URL
+
+	_, state, err := AuthCodeURL(&conf)
+	if err != nil {
+		t.Fatalf("AuthCodeURL returns error(%v)", err)
+	}
+
+	forged := url.Values{"code": {"grant"}, "state": {"forged"}}
+	if _, err := ExchangeCallback(context.Background(), &conf, state, forged); err != ErrStateMismatch {
+		t.Errorf("ExchangeCallback returns error(%v), want %v", err, ErrStateMismatch)
+	}
+
+	q := url.Values{"code": {"grant"}, "state": {state}}
+	token, err := ExchangeCallback(context.Background(), &conf, state, q)
+	if err != nil {
+		t.Fatalf("ExchangeCallback returns error(%v)", err)
+	}
+	if token.AccessToken == "" {
+		t.Errorf("ExchangeCallback returns empty access token")
+	}
+}
@@ -0,0 +1,278 @@
+package withings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// streamDecoder is implemented by the results of API calls.
+// parseResponse decodes the response body with it as a stream instead of reading the whole body into memory.
+type streamDecoder interface {
+	decodeStream(r io.Reader) error
+}
+
+func (m *Measurement) decodeStream(r io.Reader) error {
+	m.Body.Measuregrps = nil
+	return decodeSeries(r, &m.Status, &m.Body, "measuregrps", collect(&m.Body.Measuregrps))
+}
+
+func (a *Activities) decodeStream(r io.Reader) error {
+	a.Body.Activities = nil
+	return decodeSeries(r, &a.Status, &a.Body, "activities", collect(&a.Body.Activities))
+}
+
+func (w *Workouts) decodeStream(r io.Reader) error {
+	w.Body.Series = nil
+	return decodeSeries(r, &w.Status, &w.Body, "series", collect(&w.Body.Series))
+}
+
+func (s *Sleeps) decodeStream(r io.Reader) error {
+	s.Body.Series = nil
+	return decodeSeries(r, &s.Status, &s.Body, "series", collect(&s.Body.Series))
+}
+
+func (s *SleepSummaries) decodeStream(r io.Reader) error {
+	s.Body.Series = nil
+	return decodeSeries(r, &s.Status, &s.Body, "series", collect(&s.Body.Series))
+}
+
+// pager is implemented by the results which tell whether the next page exists and its offset.
+type pager interface {
+	page() (more bool, offset int)
+}
+
+func (m *Measurement) page() (bool, int)    { return m.Body.More != 0, m.Body.Offset }
+func (a *Activities) page() (bool, int)     { return a.Body.More, a.Body.Offset }
+func (w *Workouts) page() (bool, int)       { return w.Body.More, w.Body.Offset }
+func (s *SleepSummaries) page() (bool, int) { return s.Body.More, s.Body.Offset }
+
+// collect returns the function which appends the elements to s.
+func collect[T any](s *[]T) func(T) error {
+	return func(v T) error {
+		*s = append(*s, v)
+		return nil
+	}
+}
+
+// seriesFunc is the result of the Get*Func methods.
+// It passes the elements of the series to f instead of keeping them in the body.
+type seriesFunc[T any] struct {
+	status *int
+	body   interface{}
+	key    string
+	f      func(T) error
+	// owner is the result which has body.
+	owner interface{}
+}
+
+func (s *seriesFunc[T]) page() (bool, int) {
+	if p, ok := s.owner.(pager); ok {
+		return p.page()
+	}
+	return false, 0
+}
+
+func (s *seriesFunc[T]) decodeStream(r io.Reader) error {
+	n := 0
+	err := decodeSeries(r, s.status, s.body, s.key, func(v T) error {
+		if err := s.f(v); err != nil {
+			return &partialError{err: err}
+		}
+		n++
+		return nil
+	})
+	if err != nil && n > 0 {
+		// Some elements were already passed to f, so retrying the call would pass them again.
+		return &partialError{err: err}
+	}
+	return err
+}
+
+// partialError is the error of a call whose result was partly passed to the callback.
+// Such a call is not retried.
+type partialError struct {
+	err error
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// decodeSeries decodes the withings response {"status":..., "body":{...}, "error":...} from r.
+// The elements of the array named key in the body are decoded one by one and passed to f,
+// and the other fields of the body are decoded into body.
+// A non-zero status is returned as APIError as soon as it is read, so the body after it is not decoded.
+func decodeSeries[T any](r io.Reader, status *int, body interface{}, key string, f func(T) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var msg string
+	for dec.More() {
+		name, err := objectKey(dec)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "status":
+			if err := dec.Decode(status); err != nil {
+				return err
+			}
+			if *status != 0 {
+				return apiErrorAfter(dec, *status, msg)
+			}
+		case "error":
+			if err := dec.Decode(&msg); err != nil {
+				return err
+			}
+		case "body":
+			if err := decodeBody(dec, body, key, f); err != nil {
+				return err
+			}
+		default:
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if *status != 0 {
+		return &APIError{Status: *status, Message: msg}
+	}
+	return nil
+}
+
+// apiErrorAfter returns APIError of status with the error message which may follow the status.
+func apiErrorAfter(dec *json.Decoder, status int, msg string) error {
+	for msg == "" && dec.More() {
+		name, err := objectKey(dec)
+		if err != nil {
+			break
+		}
+		if name == "error" {
+			if err := dec.Decode(&msg); err != nil {
+				break
+			}
+			continue
+		}
+		if err := skipValue(dec); err != nil {
+			break
+		}
+	}
+	return &APIError{Status: status, Message: msg}
+}
+
+// decodeBody decodes the body object. See decodeSeries.
+func decodeBody[T any](dec *json.Decoder, body interface{}, key string, f func(T) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('{') {
+		// e.g. "body":[] of the error responses
+		return skipRest(dec, tok)
+	}
+
+	rest := map[string]json.RawMessage{}
+	for dec.More() {
+		name, err := objectKey(dec)
+		if err != nil {
+			return err
+		}
+		if name != key {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			rest[name] = raw
+			continue
+		}
+
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("withings: %s is %v, want an array", key, tok)
+		}
+		for dec.More() {
+			var v T
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			if err := f(v); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	// The other fields are small, so they are decoded at once.
+	b, err := json.Marshal(rest)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, body)
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("withings: unexpected %v in the response, want %v", tok, want)
+	}
+	return nil
+}
+
+func objectKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	name, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("withings: unexpected %v in the response, want an object key", tok)
+	}
+	return name, nil
+}
+
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
+// skipRest skips the rest of the value which starts with tok.
+func skipRest(dec *json.Decoder, tok json.Token) error {
+	if _, ok := tok.(json.Delim); !ok {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
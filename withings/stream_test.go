@@ -0,0 +1,248 @@
+package withings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDecodeStream(t *testing.T) {
+	jsonBlob, err := ioutil.ReadFile(testMeasureFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile returns error(%v)", err)
+	}
+
+	want := new(Measurement)
+	if err := json.Unmarshal(jsonBlob, want); err != nil {
+		t.Fatalf("json.Unmarshal returns error(%v)", err)
+	}
+	got := new(Measurement)
+	if err := got.decodeStream(bytes.NewReader(jsonBlob)); err != nil {
+		t.Fatalf("decodeStream returns error(%v)", err)
+	}
+
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("decodeStream decodes\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestDecodeStreamAPIError(t *testing.T) {
+	cases := []struct {
+		body   string
+		status int
+		msg    string
+	}{
+		{`{"status":503,"error":"Invalid params","body":{}}`, 503, "Invalid params"},
+		{`{"status":601,"body":{"measuregrps":[{"grpid":1}]},"error":"Too Many Requests"}`, 601, "Too Many Requests"},
+		// The status after the body is checked at the end.
+		{`{"body":[],"error":"Unknown","status":2555}`, 2555, "Unknown"},
+	}
+
+	for _, c := range cases {
+		var groups int
+		m := new(Measurement)
+		err := decodeSeries(strings.NewReader(c.body), &m.Status, &m.Body, "measuregrps", func(MeasureGroup) error {
+			groups++
+			return nil
+		})
+		var aerr *APIError
+		if !errors.As(err, &aerr) {
+			t.Errorf("decodeSeries(%s) returns error(%v), want APIError", c.body, err)
+			continue
+		}
+		if aerr.Status != c.status || aerr.Message != c.msg {
+			t.Errorf("decodeSeries(%s) returns %+v, want status %d and message %q", c.body, aerr, c.status, c.msg)
+		}
+		if groups != 0 {
+			t.Errorf("decodeSeries(%s) decodes %d measure groups after the error status", c.body, groups)
+		}
+	}
+}
+
+func TestDecodeStreamInvalid(t *testing.T) {
+	for _, body := range []string{
+		``,
+		`[]`,
+		`{"status":0,"body":{"measuregrps":{}}}`,
+		`{"status":0,"body":{"measuregrps":[{"grpid":1},`,
+	} {
+		m := new(Measurement)
+		if err := m.decodeStream(strings.NewReader(body)); err == nil {
+			t.Errorf("decodeStream(%s) returns no error", body)
+		}
+	}
+}
+
+// newSeriesServer returns the server which responds to getmeas with n measure groups and counts the requests.
+func newSeriesServer(n int, requests *int32) *httptest.Server {
+	payload := largeMeasurePayload(n)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(payload)
+	}))
+}
+
+func TestGetMeasFunc(t *testing.T) {
+	var requests int32
+	ts := newSeriesServer(100, &requests)
+	defer ts.Close()
+
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.SetToken(newTestToken("363"))
+	c.MeasureURL = ts.URL
+
+	var ids []int64
+	m, err := c.GetMeasFunc(context.Background(), func(g MeasureGroup) error {
+		ids = append(ids, g.GrpID)
+		return nil
+	}, Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, Weight)
+	if err != nil {
+		t.Fatalf("GetMeasFunc returns error(%v)", err)
+	}
+	if len(ids) != 100 || ids[0] != 0 || ids[99] != 99 {
+		t.Errorf("GetMeasFunc passes %d measure groups, want 100 in the order of the response", len(ids))
+	}
+	if len(m.Body.Measuregrps) != 0 {
+		t.Errorf("GetMeasFunc keeps %d measure groups, want 0", len(m.Body.Measuregrps))
+	}
+	if m.Body.Timezone != "Asia/Tokyo" || m.Body.More != 1 || m.Body.Offset != 100 {
+		t.Errorf("GetMeasFunc returns body %+v, want the fields other than measuregrps", m.Body)
+	}
+
+	// The error of the callback stops the call and it is not retried.
+	errStop := errors.New("stop")
+	var calls int
+	c.RetryPolicy = RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return true }}
+	_, err = c.GetMeasFunc(context.Background(), func(g MeasureGroup) error {
+		calls++
+		if calls == 10 {
+			return errStop
+		}
+		return nil
+	}, Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, Weight)
+	if !errors.Is(err, errStop) {
+		t.Errorf("GetMeasFunc returns error(%v), want the error of the callback", err)
+	}
+	if calls != 10 {
+		t.Errorf("GetMeasFunc calls the callback %d times, want 10", calls)
+	}
+	if requests != 2 {
+		t.Errorf("server gets %d requests, want 2", requests)
+	}
+}
+
+func TestGetMeasFuncAPIError(t *testing.T) {
+	// The status after the measure groups is read after they were passed to the callback.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"body":{"measuregrps":[{"grpid":1},{"grpid":2}]},"status":601,"error":"Too Many Requests"}`)
+	}))
+	defer ts.Close()
+
+	c, err := New("cid", "secret", "http://localhost/callback")
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	c.SetToken(newTestToken("363"))
+	c.MeasureURL = ts.URL
+	c.RetryPolicy = NoRetry
+
+	_, err = c.GetMeasFunc(context.Background(), func(MeasureGroup) error { return nil },
+		Real, time.Now().Add(-24*time.Hour), time.Now(), OffsetBase, 0, Weight)
+	var aerr *APIError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("GetMeasFunc returns error(%v), want APIError", err)
+	}
+	if aerr.Status != 601 || aerr.Action != MeasureA {
+		t.Errorf("GetMeasFunc returns %+v, want status 601 and action %s", aerr, MeasureA)
+	}
+}
+
+// largeMeasurePayload returns a getmeas response with n measure groups.
+func largeMeasurePayload(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"status":0,"body":{"updatetime":1609766464,"timezone":"Asia\/Tokyo","measuregrps":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"grpid":%d,"attrib":0,"date":%d,"created":%d,"category":1,"deviceid":"ky8zry4dk9ng7dzysa8kk2cyi7yfdwaziz6wszug","hash_deviceid":"ky8zry4dk9ng7dzysa8kk2cyi7yfdwaziz6wszug","measures":[{"value":65750,"type":1,"unit":-3,"algo":0,"fm":131},{"value":1712,"type":6,"unit":-2,"algo":0,"fm":131}],"comment":null}`, i, 1609754636+i, 1609754674+i)
+	}
+	fmt.Fprintf(&b, `],"more":1,"offset":%d}}`, n)
+	return b.Bytes()
+}
+
+// parseAll is parseResponse before the streaming decoder, which reads the whole body into memory.
+func parseAll(r io.Reader, result interface{}) error {
+	rbody, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(rbody, &envelope); err != nil {
+		return err
+	}
+	if envelope.Status != 0 {
+		return &APIError{Status: envelope.Status, Message: envelope.Error}
+	}
+	return json.Unmarshal(rbody, result)
+}
+
+// The benchmarks decode a synthetic response of 20000 measure groups (about 7MB).
+// Compare B/op: the streaming decoder does not keep the whole body in memory,
+// and GetMeasFunc does not keep the measure groups either.
+const benchMeasureGroups = 20000
+
+func BenchmarkDecodeReadAll(b *testing.B) {
+	payload := largeMeasurePayload(benchMeasureGroups)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := parseAll(bytes.NewReader(payload), new(Measurement)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStream(b *testing.B) {
+	payload := largeMeasurePayload(benchMeasureGroups)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := new(Measurement).decodeStream(bytes.NewReader(payload)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeStreamFunc(b *testing.B) {
+	payload := largeMeasurePayload(benchMeasureGroups)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := new(Measurement)
+		sf := &seriesFunc[MeasureGroup]{&m.Status, &m.Body, "measuregrps", func(MeasureGroup) error { return nil }, m}
+		if err := sf.decodeStream(bytes.NewReader(payload)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package withings
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// keyLength is the length of AES-256 key.
+	keyLength = 32
+	// saltLength is the length of the salt to derive the key from a passphrase.
+	saltLength = 16
+	// pbkdf2Iterations is the number of PBKDF2-HMAC-SHA256 iterations to derive the key from a passphrase.
+	pbkdf2Iterations = 600000
+)
+
+// encryptedMagic is the header of encrypted token files.
+// The header is followed by the salt, the nonce and the sealed token.
+var encryptedMagic = []byte("WTKN\x01")
+
+// TokenCipher encrypts token files with AES-GCM.
+// The key is given directly or derived from a passphrase with PBKDF2.
+// TokenCipher is safe for concurrent use.
+type TokenCipher struct {
+	key        []byte
+	passphrase string
+
+	// mu guards the last derived key, so the passphrase is not derived again for the same salt.
+	mu         sync.Mutex
+	salt       []byte
+	derivedKey []byte
+}
+
+// NewKeyCipher returns TokenCipher with 32 bytes key.
+func NewKeyCipher(key []byte) (*TokenCipher, error) {
+	if len(key) != keyLength {
+		return nil, errors.Errorf("key must be %d bytes, got %d bytes", keyLength, len(key))
+	}
+	return &TokenCipher{key: key}, nil
+}
+
+// NewPassphraseCipher returns TokenCipher which derives the key from passphrase.
+func NewPassphraseCipher(passphrase string) (*TokenCipher, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase is empty")
+	}
+	return &TokenCipher{passphrase: passphrase}, nil
+}
+
+// ReadKeyFile reads the key from a file. See ParseKey for the format.
+func ReadKeyFile(path2file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path2file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(b)
+}
+
+// KeyFromEnv reads the key from the environment variable name. See ParseKey for the format.
+func KeyFromEnv(name string) ([]byte, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil, errors.Errorf("environment variable %s is not set", name)
+	}
+	return ParseKey([]byte(v))
+}
+
+// ParseKey parses 32 bytes key encoded in hex or base64, or the raw 32 bytes.
+func ParseKey(b []byte) ([]byte, error) {
+	s := string(bytes.TrimSpace(b))
+	if k, err := hex.DecodeString(s); err == nil && len(k) == keyLength {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && len(k) == keyLength {
+		return k, nil
+	}
+	if k, err := base64.RawURLEncoding.DecodeString(s); err == nil && len(k) == keyLength {
+		return k, nil
+	}
+	if len(b) == keyLength {
+		return b, nil
+	}
+	return nil, errors.Errorf("key must be %d bytes in hex, base64 or raw", keyLength)
+}
+
+// keyFor returns the AES key for salt.
+func (c *TokenCipher) keyFor(salt []byte) ([]byte, error) {
+	if c.key != nil {
+		return c.key, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.derivedKey != nil && bytes.Equal(c.salt, salt) {
+		return c.derivedKey, nil
+	}
+	k, err := pbkdf2.Key(sha256.New, c.passphrase, salt, pbkdf2Iterations, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	c.salt = append([]byte(nil), salt...)
+	c.derivedKey = k
+	return k, nil
+}
+
+// newSalt returns the salt for Seal. The salt is reused while the cipher lives to avoid deriving the key every time.
+func (c *TokenCipher) newSalt() ([]byte, error) {
+	c.mu.Lock()
+	salt := c.salt
+	c.mu.Unlock()
+	if salt != nil {
+		return salt, nil
+	}
+
+	salt = make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts plaintext.
+func (c *TokenCipher) Seal(plaintext []byte) ([]byte, error) {
+	salt, err := c.newSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.keyFor(salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(encryptedMagic)+len(salt)+len(nonce))
+	header = append(header, encryptedMagic...)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	// The header is authenticated as additional data. dst and additionalData of Seal must not overlap,
+	// so the sealed token is appended to a copy of the header.
+	out := make([]byte, len(header), len(header)+len(plaintext)+gcm.Overhead())
+	copy(out, header)
+	return gcm.Seal(out, nonce, plaintext, header), nil
+}
+
+// Open decrypts data sealed by Seal.
+func (c *TokenCipher) Open(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return nil, errors.New("data is not encrypted")
+	}
+	salt := data[len(encryptedMagic) : len(encryptedMagic)+saltLength]
+	key, err := c.keyFor(salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hlen := len(encryptedMagic) + saltLength + gcm.NonceSize()
+	if len(data) < hlen {
+		return nil, errors.New("encrypted data is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[hlen-gcm.NonceSize():hlen], data[hlen:], data[:hlen])
+	if err != nil {
+		return nil, errors.New("cannot decrypt token: wrong key or broken data")
+	}
+	return plaintext, nil
+}
+
+// isEncrypted reports whether data was sealed by TokenCipher.
+func isEncrypted(data []byte) bool {
+	return len(data) >= len(encryptedMagic)+saltLength && bytes.HasPrefix(data, encryptedMagic)
+}
+
+// MigrateTokenFile rewrites a plaintext token file encrypted with c.
+// It does nothing if the file is already encrypted.
+func MigrateTokenFile(path2file string, c *TokenCipher) error {
+	_, err := readTokenFile(path2file, c)
+	return err
+}
@@ -0,0 +1,99 @@
+package withings
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenCipherSealOpen(t *testing.T) {
+	kc, err := NewKeyCipher(bytes.Repeat([]byte{1}, keyLength))
+	if err != nil {
+		t.Fatalf("NewKeyCipher returns error(%v)", err)
+	}
+	pc, err := NewPassphraseCipher("passphrase")
+	if err != nil {
+		t.Fatalf("NewPassphraseCipher returns error(%v)", err)
+	}
+
+	plain := []byte(`{"access_token":"access"}`)
+	for _, c := range []*TokenCipher{kc, pc} {
+		sealed, err := c.Seal(plain)
+		if err != nil {
+			t.Fatalf("Seal returns error(%v)", err)
+		}
+		if bytes.Contains(sealed, []byte("access")) {
+			t.Errorf("sealed data contains plaintext")
+		}
+		got, err := c.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open returns error(%v)", err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("Open = %s, want %s", got, plain)
+		}
+	}
+
+	sealed, _ := kc.Seal(plain)
+	other, _ := NewKeyCipher(bytes.Repeat([]byte{2}, keyLength))
+	if _, err := other.Open(sealed); err == nil {
+		t.Errorf("Open with wrong key returns no error")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, keyLength)
+	for _, s := range []string{hex.EncodeToString(key) + "\n", string(key)} {
+		got, err := ParseKey([]byte(s))
+		if err != nil {
+			t.Errorf("ParseKey returns error(%v)", err)
+		} else if !bytes.Equal(got, key) {
+			t.Errorf("ParseKey = %x, want %x", got, key)
+		}
+	}
+	if _, err := ParseKey([]byte("short")); err == nil {
+		t.Errorf("ParseKey returns no error for short key")
+	}
+}
+
+func TestEncryptedFileTokenStoreMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withings")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returns error(%v)", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access_token.json")
+
+	// plaintext file written by older versions
+	plain := &FileTokenStore{Path: path}
+	if err := plain.Save("", newTestToken("363")); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+
+	c, _ := NewKeyCipher(bytes.Repeat([]byte{1}, keyLength))
+	s := &FileTokenStore{Path: path, Cipher: c}
+	got, err := s.Load("")
+	if err != nil {
+		t.Fatalf("Load returns error(%v)", err)
+	}
+	if got.RefreshToken != "refresh" || TokenUserID(got) != "363" {
+		t.Errorf("Load = %+v, want the saved token", got)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile returns error(%v)", err)
+	}
+	if !isEncrypted(b) {
+		t.Errorf("token file was not migrated: %s", b)
+	}
+	if _, err := plain.Load(""); err == nil {
+		t.Errorf("Load without cipher returns no error for encrypted file")
+	}
+	if _, err := s.Load(""); err != nil {
+		t.Errorf("Load of encrypted file returns error(%v)", err)
+	}
+}
@@ -0,0 +1,137 @@
+package withings
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// maskedPrefix is the number of characters of a secret which are left unmasked.
+const maskedPrefix = 4
+
+// mask masks a secret for logs.
+func mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= maskedPrefix*2 {
+		return "****"
+	}
+	return s[:maskedPrefix] + "****"
+}
+
+// TokenInfo is the information of a token for logs and health checks.
+// The access token and the refresh token are masked.
+type TokenInfo struct {
+	UserID    string
+	Scopes    []Scope
+	TokenType string
+	// Expiry is zero if the token does not expire.
+	Expiry time.Time
+	// ExpiresIn is the remaining lifetime of the access token. It is zero if the token has expired.
+	ExpiresIn time.Duration
+	// Valid reports whether the access token can be used without refresh.
+	Valid bool
+	// Refreshable reports whether the token has a refresh token.
+	Refreshable  bool
+	AccessToken  string
+	RefreshToken string
+}
+
+// NewTokenInfo returns TokenInfo of t.
+func NewTokenInfo(t *oauth2.Token) TokenInfo {
+	return newTokenInfo(t, time.Now())
+}
+
+func newTokenInfo(t *oauth2.Token, now time.Time) TokenInfo {
+	if t == nil {
+		return TokenInfo{}
+	}
+	scopes, _ := TokenScopes(t)
+	info := TokenInfo{
+		UserID:       TokenUserID(t),
+		Scopes:       scopes,
+		TokenType:    t.Type(),
+		Expiry:       t.Expiry,
+		Valid:        t.Valid(),
+		Refreshable:  t.RefreshToken != "",
+		AccessToken:  mask(t.AccessToken),
+		RefreshToken: mask(t.RefreshToken),
+	}
+	if !t.Expiry.IsZero() && t.Expiry.After(now) {
+		info.ExpiresIn = t.Expiry.Sub(now)
+	}
+	return info
+}
+
+// TokenInfo returns TokenInfo of the token of client.
+func (c *Client) TokenInfo() TokenInfo {
+	return NewTokenInfo(c.CurrentToken())
+}
+
+// String returns one line summary of the token.
+func (i TokenInfo) String() string {
+	expiry := "never"
+	if !i.Expiry.IsZero() {
+		expiry = i.Expiry.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("userid=%s scopes=%s type=%s valid=%t expiry=%s expires_in=%s refreshable=%t access_token=%s refresh_token=%s",
+		i.UserID, joinScopes(i.Scopes), i.TokenType, i.Valid, expiry, i.ExpiresIn.Round(time.Second), i.Refreshable, i.AccessToken, i.RefreshToken)
+}
+
+// MarshalJSON marshals TokenInfo with expires_in in seconds.
+func (i TokenInfo) MarshalJSON() ([]byte, error) {
+	var expiry *time.Time
+	if !i.Expiry.IsZero() {
+		expiry = &i.Expiry
+	}
+	return json.Marshal(struct {
+		UserID       string     `json:"userid,omitempty"`
+		Scopes       []Scope    `json:"scopes,omitempty"`
+		TokenType    string     `json:"token_type,omitempty"`
+		Expiry       *time.Time `json:"expiry,omitempty"`
+		ExpiresIn    int64      `json:"expires_in"`
+		Valid        bool       `json:"valid"`
+		Refreshable  bool       `json:"refreshable"`
+		AccessToken  string     `json:"access_token,omitempty"`
+		RefreshToken string     `json:"refresh_token,omitempty"`
+	}{
+		i.UserID, i.Scopes, i.TokenType, expiry, int64(i.ExpiresIn / time.Second), i.Valid, i.Refreshable, i.AccessToken, i.RefreshToken,
+	})
+}
+
+// ConfInfo is the information of oauth2.Config for logs. The client secret is masked.
+type ConfInfo struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	AuthURL      string   `json:"auth_url"`
+	TokenURL     string   `json:"token_url"`
+}
+
+// NewConfInfo returns ConfInfo of conf.
+func NewConfInfo(conf *oauth2.Config) ConfInfo {
+	return ConfInfo{
+		ClientID:     conf.ClientID,
+		ClientSecret: mask(conf.ClientSecret),
+		RedirectURL:  conf.RedirectURL,
+		Scopes:       conf.Scopes,
+		AuthURL:      conf.Endpoint.AuthURL,
+		TokenURL:     conf.Endpoint.TokenURL,
+	}
+}
+
+// ConfInfo returns ConfInfo of the client.
+func (c *Client) ConfInfo() ConfInfo {
+	return NewConfInfo(c.Conf)
+}
+
+// String returns one line summary of the config.
+func (i ConfInfo) String() string {
+	return fmt.Sprintf("client_id=%s client_secret=%s redirect_url=%s scopes=%s auth_url=%s token_url=%s",
+		i.ClientID, i.ClientSecret, i.RedirectURL, strings.Join(i.Scopes, ","), i.AuthURL, i.TokenURL)
+}
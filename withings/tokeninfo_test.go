@@ -0,0 +1,46 @@
+package withings
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenInfo(t *testing.T) {
+	tk := newTestToken("363")
+	tk.AccessToken = "a075f8c14fb8df40b08ebc8508533dc332a6910a"
+	now := tk.Expiry.Add(-30 * time.Minute)
+
+	info := newTokenInfo(tk, now)
+	if info.UserID != "363" {
+		t.Errorf("UserID = %s, want 363", info.UserID)
+	}
+	if info.ExpiresIn != 30*time.Minute {
+		t.Errorf("ExpiresIn = %v, want 30m", info.ExpiresIn)
+	}
+	if len(info.Scopes) != 2 || info.Scopes[1] != ScopeMetrics {
+		t.Errorf("Scopes = %v, want [user.info user.metrics]", info.Scopes)
+	}
+
+	b, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("json.Marshal returns error(%v)", err)
+	}
+	for _, s := range []string{info.String(), string(b)} {
+		if strings.Contains(s, tk.AccessToken) {
+			t.Errorf("%s contains the access token", s)
+		}
+	}
+	if !strings.Contains(string(b), `"expires_in":1800`) {
+		t.Errorf("json = %s, want expires_in 1800", b)
+	}
+}
+
+func TestConfInfo(t *testing.T) {
+	conf := GetNewConf("cid", "a-very-secret-secret", "https://example.com/")
+	info := NewConfInfo(&conf)
+	if strings.Contains(info.String(), conf.ClientSecret) {
+		t.Errorf("ConfInfo.String() = %s, contains the client secret", info)
+	}
+}
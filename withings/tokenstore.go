@@ -0,0 +1,301 @@
+package withings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenNotFound is returned by TokenStore when no token is stored for the user.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore loads and persists tokens keyed by withings userid.
+type TokenStore interface {
+	// Load returns the token of userid. It returns ErrTokenNotFound if there is no token.
+	Load(userid string) (*oauth2.Token, error)
+	// Save stores the token of userid.
+	Save(userid string, token *oauth2.Token) error
+	// Delete removes the token of userid. Deleting a token which does not exist is not an error.
+	Delete(userid string) error
+}
+
+// TokenLister is implemented by TokenStore which can list the users it has tokens of.
+type TokenLister interface {
+	Users() ([]string, error)
+}
+
+// TokenUserID returns withings userid of the token.
+// userid is taken from the token extras, so it returns "" if the token does not have it.
+func TokenUserID(t *oauth2.Token) string {
+	if t == nil {
+		return ""
+	}
+	switch v := t.Extra("userid").(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// storedToken is the file format of a token.
+// Extras of oauth2.Token are not marshaled, so userid and scope are kept beside the token.
+type storedToken struct {
+	oauth2.Token
+	UserID string `json:"userid,omitempty"`
+	Scope  string `json:"scope,omitempty"`
+}
+
+func newStoredToken(t *oauth2.Token) *storedToken {
+	st := &storedToken{Token: *t, UserID: TokenUserID(t)}
+	if s, ok := t.Extra("scope").(string); ok {
+		st.Scope = s
+	}
+	return st
+}
+
+func (st *storedToken) token() *oauth2.Token {
+	t := &st.Token
+	if st.UserID == "" && st.Scope == "" {
+		return t
+	}
+	extra := map[string]interface{}{}
+	if st.UserID != "" {
+		extra["userid"] = st.UserID
+	}
+	if st.Scope != "" {
+		extra["scope"] = st.Scope
+	}
+	return t.WithExtra(extra)
+}
+
+// readTokenFile reads the token from path2file.
+// If c is not nil, the file is decrypted with c. A plaintext file is rewritten encrypted.
+func readTokenFile(path2file string, c *TokenCipher) (*oauth2.Token, error) {
+	b, err := ioutil.ReadFile(path2file)
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := isEncrypted(b)
+	switch {
+	case encrypted && c == nil:
+		return nil, errors.Errorf("token file %s is encrypted, but cipher is not set", path2file)
+	case encrypted:
+		if b, err = c.Open(b); err != nil {
+			return nil, fmt.Errorf("cannot read token file %s: %w", path2file, err)
+		}
+	}
+
+	st := &storedToken{}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("cannot decode token file %s: %w", path2file, err)
+	}
+	t := st.token()
+
+	if c != nil && !encrypted {
+		// migrate the plaintext file
+		if err := writeTokenFile(path2file, t, c); err != nil {
+			return nil, fmt.Errorf("cannot encrypt token file %s: %w", path2file, err)
+		}
+	}
+	return t, nil
+}
+
+// writeTokenFile writes the token to path2file atomically with 0600 permission.
+// If c is not nil, the file is encrypted with c.
+func writeTokenFile(path2file string, t *oauth2.Token, c *TokenCipher) error {
+	b, err := json.Marshal(newStoredToken(t))
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		if b, err = c.Seal(b); err != nil {
+			return err
+		}
+	}
+
+	// ioutil.TempFile creates the file with 0600 permission.
+	f, err := ioutil.TempFile(filepath.Dir(path2file), "."+filepath.Base(path2file)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path2file)
+}
+
+// FileTokenStore stores a single token in a JSON file.
+// userid is ignored, so use DirTokenStore for several users.
+type FileTokenStore struct {
+	Path string
+	// Cipher encrypts the file if it is set. A plaintext file is encrypted when it is loaded.
+	Cipher *TokenCipher
+}
+
+// Load reads the token from the file.
+func (s *FileTokenStore) Load(userid string) (*oauth2.Token, error) {
+	return readTokenFile(s.Path, s.Cipher)
+}
+
+// Save writes the token to the file.
+func (s *FileTokenStore) Save(userid string, token *oauth2.Token) error {
+	return writeTokenFile(s.Path, token, s.Cipher)
+}
+
+// Delete removes the file.
+func (s *FileTokenStore) Delete(userid string) error {
+	if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DirTokenStore stores tokens in a directory as <userid>.json per user.
+type DirTokenStore struct {
+	Dir string
+	// Cipher encrypts the files if it is set. Plaintext files are encrypted when they are loaded.
+	Cipher *TokenCipher
+}
+
+// path returns the file path of userid's token.
+func (s *DirTokenStore) path(userid string) (string, error) {
+	if userid == "" || userid != filepath.Base(userid) || strings.HasPrefix(userid, ".") {
+		return "", errors.Errorf("invalid userid %q", userid)
+	}
+	return filepath.Join(s.Dir, userid+".json"), nil
+}
+
+// Load reads the token of userid.
+func (s *DirTokenStore) Load(userid string) (*oauth2.Token, error) {
+	p, err := s.path(userid)
+	if err != nil {
+		return nil, err
+	}
+	return readTokenFile(p, s.Cipher)
+}
+
+// Save writes the token of userid.
+func (s *DirTokenStore) Save(userid string, token *oauth2.Token) error {
+	p, err := s.path(userid)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	return writeTokenFile(p, token, s.Cipher)
+}
+
+// Delete removes the token of userid.
+func (s *DirTokenStore) Delete(userid string) error {
+	p, err := s.path(userid)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Users returns userids which have token files in Dir.
+func (s *DirTokenStore) Users() ([]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users := []string{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		users = append(users, strings.TrimSuffix(name, ".json"))
+	}
+	return users, nil
+}
+
+// MemoryTokenStore stores tokens in memory. It is safe for concurrent use.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]*oauth2.Token
+}
+
+// NewMemoryTokenStore returns empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: map[string]*oauth2.Token{}}
+}
+
+// Load returns the token of userid.
+func (s *MemoryTokenStore) Load(userid string) (*oauth2.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[userid]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return t, nil
+}
+
+// Save stores the token of userid.
+func (s *MemoryTokenStore) Save(userid string, token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = map[string]*oauth2.Token{}
+	}
+	s.tokens[userid] = token
+	return nil
+}
+
+// Delete removes the token of userid.
+func (s *MemoryTokenStore) Delete(userid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, userid)
+	return nil
+}
+
+// Users returns userids which have tokens.
+func (s *MemoryTokenStore) Users() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]string, 0, len(s.tokens))
+	for u := range s.tokens {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users, nil
+}
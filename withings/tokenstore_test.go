@@ -0,0 +1,99 @@
+package withings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestToken(userid string) *oauth2.Token {
+	t := &oauth2.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(time.Hour).Round(time.Second),
+	}
+	return t.WithExtra(map[string]interface{}{"userid": userid, "scope": "user.info,user.metrics"})
+}
+
+func TestDirTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "withings")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returns error(%v)", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &DirTokenStore{Dir: filepath.Join(dir, "tokens")}
+	if _, err := s.Load("363"); err != ErrTokenNotFound {
+		t.Errorf("Load returns error(%v), want %v", err, ErrTokenNotFound)
+	}
+
+	if err := s.Save("363", newTestToken("363")); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "tokens", "363.json"))
+	if err != nil {
+		t.Fatalf("os.Stat returns error(%v)", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("token file permission = %v, want 0600", fi.Mode().Perm())
+	}
+
+	got, err := s.Load("363")
+	if err != nil {
+		t.Fatalf("Load returns error(%v)", err)
+	}
+	if got.AccessToken != "access" || got.RefreshToken != "refresh" {
+		t.Errorf("Load = %+v, want the saved token", got)
+	}
+	if TokenUserID(got) != "363" {
+		t.Errorf("TokenUserID = %s, want 363", TokenUserID(got))
+	}
+	if got.Extra("scope") != "user.info,user.metrics" {
+		t.Errorf("scope = %v, want user.info,user.metrics", got.Extra("scope"))
+	}
+
+	if err := s.Delete("363"); err != nil {
+		t.Errorf("Delete returns error(%v)", err)
+	}
+	if _, err := s.Load("363"); err != ErrTokenNotFound {
+		t.Errorf("Load after Delete returns error(%v), want %v", err, ErrTokenNotFound)
+	}
+
+	if err := s.Save("../363", newTestToken("363")); err == nil {
+		t.Errorf("Save with invalid userid returns no error")
+	}
+}
+
+func TestFileTokenStoreDecodeError(t *testing.T) {
+	f, err := ioutil.TempFile("", "token")
+	if err != nil {
+		t.Fatalf("ioutil.TempFile returns error(%v)", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not json")
+	f.Close()
+
+	s := &FileTokenStore{Path: f.Name()}
+	if _, err := s.Load(""); err == nil {
+		t.Errorf("Load returns no error for broken file")
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	var s MemoryTokenStore
+	if err := s.Save("363", newTestToken("363")); err != nil {
+		t.Fatalf("Save returns error(%v)", err)
+	}
+	if _, err := s.Load("363"); err != nil {
+		t.Errorf("Load returns error(%v)", err)
+	}
+	s.Delete("363")
+	if _, err := s.Load("363"); err != ErrTokenNotFound {
+		t.Errorf("Load after Delete returns error(%v), want %v", err, ErrTokenNotFound)
+	}
+}
@@ -0,0 +1,109 @@
+package withings
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// countingTransport counts the requests sent with http.DefaultTransport.
+type countingTransport struct {
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewTokenTransport(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	base := &countingTransport{}
+	conf := GetNewConf("cid", "secret", "http://localhost/callback")
+	conf.Endpoint.TokenURL = ts.URL
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: NewTokenTransport(base)})
+
+	token, err := conf.Exchange(ctx, "code")
+	if err != nil {
+		t.Fatalf("Exchange returns error(%v)", err)
+	}
+	if token.AccessToken != "access-authorization_code" || token.RefreshToken != "refresh" || TokenUserID(token) != "363" || token.Expiry.IsZero() {
+		t.Errorf("token = %+v, userid %s", token, TokenUserID(token))
+	}
+	if base.n != 1 {
+		t.Errorf("base transport got %d requests, want 1", base.n)
+	}
+
+	_, err = conf.Exchange(ctx, "bad")
+	var rerr *oauth2.RetrieveError
+	if !errors.As(err, &rerr) || !strings.Contains(string(rerr.Body), "invalid code") {
+		t.Errorf("Exchange returns error(%v), want RetrieveError", err)
+	}
+}
+
+func TestTokenTransportDoesNotModifyRequest(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {"code"}}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := NewTokenTransport(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip returns error(%v)", err)
+	}
+	resp.Body.Close()
+	if req.PostForm != nil {
+		t.Errorf("RoundTrip modified PostForm of the request: %v", req.PostForm)
+	}
+}
+
+func TestExchangeCallbackTransport(t *testing.T) {
+	ts := newTokenServer(t)
+	defer ts.Close()
+
+	// ExchangeCallback uses the transport in ctx.
+	base := &countingTransport{}
+	conf := GetNewConf("cid", "secret", "http://localhost/callback")
+	conf.Endpoint.TokenURL = ts.URL
+	query := url.Values{"code": {"code"}, "state": {"state"}}
+	if _, err := ExchangeCallback(contextWithTransport(context.Background(), base), &conf, "state", query); err != nil {
+		t.Fatalf("ExchangeCallback returns error(%v)", err)
+	}
+	if base.n != 1 {
+		t.Errorf("base transport got %d requests, want 1", base.n)
+	}
+
+	// Client.ExchangeCallback uses the transport and the middlewares of the client.
+	base = &countingTransport{}
+	var actions []string
+	c, err := New("cid", "secret", "http://localhost/callback",
+		WithEndpoints(Endpoints{TokenURL: ts.URL}),
+		WithTransport(base),
+		WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				actions = append(actions, ActionFromContext(req.Context()))
+				return next.RoundTrip(req)
+			})
+		}))
+	if err != nil {
+		t.Fatalf("New returns error(%v)", err)
+	}
+	if _, err := c.ExchangeCallback(context.Background(), "state", query); err != nil {
+		t.Fatalf("Client.ExchangeCallback returns error(%v)", err)
+	}
+	if base.n != 1 || len(actions) != 1 || actions[0] != RequestTokenA {
+		t.Errorf("base transport got %d requests, middleware got %v", base.n, actions)
+	}
+	if c.CurrentToken().AccessToken != "access-authorization_code" {
+		t.Errorf("token of the client = %s, want access-authorization_code", c.CurrentToken().AccessToken)
+	}
+}